@@ -21,6 +21,8 @@ import (
 )
 
 const (
+	atFlag          = "at"
+	futureFlag      = "future"
 	port            = 8100
 	serveFlag       = "serve"
 	sourceDir       = "src"
@@ -34,7 +36,9 @@ var (
 		dist:           {},
 		"node_modules": {},
 	}
-	serve *bool
+	at     *string
+	future *bool
+	serve  *bool
 )
 
 // Builder is a function that builds a source file src into a destination
@@ -47,6 +51,12 @@ func newBuildCmd() *cobra.Command {
 		Short: "Build a Winter project",
 		Long: cliutils.Sprintf(`
 			Build the Winter project in the current directory into ` + "`./dist`" + `.
+
+			Documents dated in the future are built,
+			but left out of listings and feeds until their date arrives.
+			Pass ` + "`--future`" + ` to list them anyway.
+			Pass ` + "`--at <date>`" + ` to build as if it were that date,
+			e.g. to reproduce a scheduled build.
 		`),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			slog.Debug("Reading config.")
@@ -54,6 +64,19 @@ func newBuildCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			if *at != "" {
+				t, err := parseAt(*at)
+				if err != nil {
+					return err
+				}
+				cfg.At = t
+			}
+			if *future {
+				cfg.Future = true
+			}
+			if *serve {
+				cfg.Serving = true
+			}
 
 			slog.Debug("Building substructure.")
 			s, err := document.NewSubstructure(cfg)
@@ -118,10 +141,38 @@ func newBuildCmd() *cobra.Command {
 		false,
 		"start a webserver and rebuild on file changes",
 	)
+	future = f.Bool(
+		futureFlag,
+		false,
+		"list documents dated in the future as if already published",
+	)
+	at = f.String(
+		atFlag,
+		"",
+		"build as if the current time were this date (YYYY-MM-DD or RFC 3339)",
+	)
 
 	return buildCmd
 }
 
+// parseAt parses the value of the --at flag.
+// It accepts a date (2006-01-02) or a full RFC 3339 timestamp.
+func parseAt(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf(
+			"cannot parse --%s %q as YYYY-MM-DD or RFC 3339: %w",
+			atFlag,
+			s,
+			err,
+		)
+	}
+	return t, nil
+}
+
 func listenForCtrlC(stop chan struct{}, srvr *http.Server, reloader *Reloader) {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
@@ -53,3 +53,27 @@ func TestServeWithListenerAnnouncesURL(t *testing.T) {
 		t.Fatalf("serveWithListener: %v", err)
 	}
 }
+
+func TestParseAt(t *testing.T) {
+	t.Parallel()
+
+	for _, test := range []struct {
+		in   string
+		want time.Time
+	}{
+		{in: "2025-06-01", want: time.Date(2025, time.June, 1, 0, 0, 0, 0, time.UTC)},
+		{in: "2025-06-01T12:30:00Z", want: time.Date(2025, time.June, 1, 12, 30, 0, 0, time.UTC)},
+	} {
+		got, err := parseAt(test.in)
+		if err != nil {
+			t.Fatalf("parseAt(%q): %v", test.in, err)
+		}
+		if !got.Equal(test.want) {
+			t.Errorf("parseAt(%q) = %s, want %s", test.in, got, test.want)
+		}
+	}
+
+	if _, err := parseAt("June 1st"); err == nil {
+		t.Errorf("parseAt(%q) returned no error", "June 1st")
+	}
+}
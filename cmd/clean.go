@@ -18,7 +18,7 @@ func newCleanCmd() *cobra.Command {
 			Purges the internal Winter cache and the current directory's generated site.
 
 			This should be used instead of manually removing dist/,
-			because Winter stores some cache files for large images internally.
+			because Winter stores some cache files for large images and diagrams internally.
 		`),
 		Args: cobra.ExactArgs(0),
 		RunE: func(cmd *cobra.Command, args []string) error {
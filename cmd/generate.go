@@ -24,7 +24,7 @@ func newGenerateCommand() *cobra.Command {
 			This should never need to be run manually.
 			It is run as part of Winter's build process.
 
-			Currently, it only generates a YAML schema for winter.yml.
+			Without a subcommand, it generates a YAML schema for winter.yml.
 		`),
 		Args:   cobra.NoArgs,
 		Hidden: true,
@@ -32,6 +32,41 @@ func newGenerateCommand() *cobra.Command {
 			return runGenerateCmd(os.Stdin, os.Stdout)
 		},
 	}
+	cmd.AddCommand(newGenerateCSSCommand())
+	return cmd
+}
+
+func newGenerateCSSCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "css",
+		Short: "Generate CSS for syntax highlighting",
+		Long: cliutils.Sprintf(`
+			Write CSS that colors syntax-highlighted code blocks to standard output.
+
+			The colors come from the Chroma style named by --style,
+			or by highlight.style in winter.yml if --style is not given.
+			For a gallery of styles, see https://xyproto.github.io/splash/docs/.
+
+			For example:
+
+			` + "```" + `sh
+			winter generate css --style monokai > public/syntax.css
+			` + "```" + `
+		`),
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			style, err := cmd.Flags().GetString("style")
+			if err != nil {
+				return err
+			}
+			cfg, err := document.NewConfig()
+			if err != nil {
+				return err
+			}
+			return document.WriteHighlightCSS(cmd.OutOrStdout(), cfg, style)
+		},
+	}
+	cmd.Flags().String("style", "", "name of the Chroma style to use")
 	return cmd
 }
 
@@ -6,6 +6,7 @@ import (
 	"log/slog"
 	"os"
 
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"twos.dev/winter/cliutils"
 )
@@ -52,9 +53,14 @@ func Execute(version string) {
 		`),
 		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 			verbosity := moreVerbose - lessVerbose
+			// libasciidoc logs through logrus,
+			// at the info level for every paragraph it parses,
+			// so only let it warn.
+			logrus.SetLevel(logrus.WarnLevel)
 			switch verbosity {
 			case -1:
 				opts.Level = slog.LevelError
+				logrus.SetLevel(logrus.ErrorLevel)
 			case 0:
 				opts.Level = slog.LevelWarn
 			case 1:
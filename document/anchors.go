@@ -0,0 +1,131 @@
+package document // import "twos.dev/winter/document"
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// orgHeadlineID matches the IDs go-org gives headlines without a CUSTOM_ID property.
+// They are numbered by position,
+// so they change whenever a headline is added above,
+// and are replaced with IDs generated from the headline text.
+var orgHeadlineID = regexp.MustCompile(`^headline-\d+$`)
+
+// headings returns the <h2> through <h6> elements of the document, in order.
+func (doc *HTMLDocument) headings() []*html.Node {
+	return allOfTypes(doc.root, map[atom.Atom]struct{}{
+		atom.H2: {},
+		atom.H3: {},
+		atom.H4: {},
+		atom.H5: {},
+		atom.H6: {},
+	})
+}
+
+// setHeadingIDs gives every heading without an ID one generated from its text,
+// following the configured slug rules.
+// IDs already in the document are kept,
+// and generated IDs that would collide with any of them,
+// or with each other,
+// are suffixed with a number.
+//
+// For example, two headings both called "Fire" get the IDs fire and fire-1.
+func (doc *HTMLDocument) setHeadingIDs() {
+	var rules SlugRules
+	if doc.s != nil && doc.s.cfg != nil {
+		rules = doc.s.cfg.Headings.Slug
+	}
+	sep := rules.Separator
+	if sep == "" {
+		sep = "-"
+	}
+	isOrg := filepath.Ext(sourceFile(doc.meta.SourcePath)) == orgSuffix
+	generated := func(id string) bool {
+		return id == "" || isOrg && orgHeadlineID.MatchString(id)
+	}
+
+	used := map[string]struct{}{"toc": {}}
+	for _, n := range allOfNodeTypes(doc.root, map[html.NodeType]struct{}{html.ElementNode: {}}) {
+		id := attr(n, atom.Id)
+		if generated(id) && hi[n.DataAtom] >= 2 {
+			continue
+		}
+		if id != "" {
+			used[id] = struct{}{}
+		}
+	}
+
+	for _, h := range doc.headings() {
+		if !generated(attr(h, atom.Id)) {
+			continue
+		}
+		base := rules.slugify(stripTemplateActions(text(h)))
+		if base == "" {
+			base = "section"
+		}
+		id := base
+		for i := 1; ; i++ {
+			if _, ok := used[id]; !ok {
+				break
+			}
+			id = base + sep + strconv.Itoa(i)
+		}
+		used[id] = struct{}{}
+		setAttr(h, atom.Id, id)
+	}
+}
+
+// insertHeadingLinks appends a link to itself to every heading,
+// if configured to or if the document has a table of contents.
+// In documents with a table of contents,
+// each heading also links back up to it.
+func (doc *HTMLDocument) insertHeadingLinks() error {
+	enabled := doc.s != nil && doc.s.cfg != nil && doc.s.cfg.Headings.Links
+	if !enabled && !doc.meta.TOC {
+		return nil
+	}
+	t, err := template.New("heading links").Parse(tocReturn)
+	if err != nil {
+		return fmt.Errorf("cannot parse heading links: %w", err)
+	}
+	for _, h := range doc.headings() {
+		id := attr(h, atom.Id)
+		if id == "" {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, struct {
+			Anchor string
+			TOC    bool
+		}{Anchor: id, TOC: doc.meta.TOC}); err != nil {
+			return fmt.Errorf("cannot execute heading links for %q: %w", id, err)
+		}
+		links, err := html.ParseFragment(&buf, h)
+		if err != nil {
+			return fmt.Errorf("cannot parse heading links for %q: %w", id, err)
+		}
+		for _, link := range links {
+			h.AppendChild(link)
+		}
+	}
+	return nil
+}
+
+// setAttr sets the attr attribute of the given element node to val,
+// adding it if it does not exist.
+func setAttr(n *html.Node, attr atom.Atom, val string) {
+	for i, a := range n.Attr {
+		if a.Key == attr.String() {
+			n.Attr[i].Val = val
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: attr.String(), Val: val})
+}
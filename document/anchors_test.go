@@ -0,0 +1,78 @@
+package document // import "twos.dev/winter/document"
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestHTMLHeadingIDs(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		src    string
+		input  string
+		rules  SlugRules
+		links  bool
+		expect []string
+	}{
+		{
+			name:   "Generated",
+			input:  `<h2>Fire &amp; Heat</h2><h3><em>Cooling</em> down</h3>`,
+			expect: []string{`<h2 id="fire-heat">`, `<h3 id="cooling-down">`},
+		},
+		{
+			name:   "Deduplicated",
+			input:  `<p id="fire">Intro</p><h2>Fire</h2><h2>Fire</h2><h2>TOC</h2>`,
+			expect: []string{`<h2 id="fire-1">`, `<h2 id="fire-2">`, `<h2 id="toc-1">`},
+		},
+		{
+			name:   "Explicit",
+			input:  `<h2 id="custom">Fire</h2><h2>Fire</h2>`,
+			expect: []string{`<h2 id="custom">`, `<h2 id="fire">`},
+		},
+		{
+			name:   "OrgHeadline",
+			src:    "src/test/OrgHeadline.org",
+			input:  `<h2 id="headline-1">Fire</h2>`,
+			expect: []string{`<h2 id="fire">`},
+		},
+		{
+			name:   "Rules",
+			input:  `<h2>Café Crème</h2>`,
+			rules:  SlugRules{ASCII: true, KeepCase: true, Separator: "_"},
+			expect: []string{`<h2 id="Cafe_Creme">`},
+		},
+		{
+			name:   "Links",
+			input:  `<h2>Fire</h2>`,
+			links:  true,
+			expect: []string{`<a href="#fire" style="text-decoration:none">#</a>`},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			src := test.src
+			if src == "" {
+				src = "src/test/" + test.name
+			}
+			cfg := &Config{}
+			cfg.Headings.Links = test.links
+			cfg.Headings.Slug = test.rules
+			doc := NewHTMLDocument(
+				src,
+				NewMetadata(src, filepath.Join("testdata", "templates")),
+				&Substructure{cfg: cfg},
+				nil,
+			)
+			assert.NilError(t, doc.Load(strings.NewReader(test.input)))
+			var actual bytes.Buffer
+			assert.NilError(t, doc.Render(&actual))
+			for _, want := range test.expect {
+				assert.Assert(t, strings.Contains(actual.String(), want), actual.String())
+			}
+			assert.Assert(t, test.links || !strings.Contains(actual.String(), `href="#`), actual.String())
+		})
+	}
+}
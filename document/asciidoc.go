@@ -0,0 +1,124 @@
+package document // import "twos.dev/winter/document"
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+
+	"github.com/bytesparadise/libasciidoc/pkg/configuration"
+	"github.com/bytesparadise/libasciidoc/pkg/parser"
+	"github.com/bytesparadise/libasciidoc/pkg/renderer"
+	"github.com/bytesparadise/libasciidoc/pkg/types"
+)
+
+// AsciiDocDocument represents a source file written in AsciiDoc.
+//
+// AsciiDocDocument implements [Document].
+//
+// The AsciiDocDocument is transitory;
+// its only purpose is to create an [HTMLDocument].
+type AsciiDocDocument struct {
+	// SourcePath is the path on disk to the file this AsciiDoc is read from or generated from.
+	// The path is relative to the working directory.
+	SourcePath string
+
+	deps map[string]struct{}
+	meta *Metadata
+	// next is the HTML document generated from this AsciiDoc document.
+	next Document
+}
+
+// NewAsciiDocDocument creates a new document whose original source is at path src.
+//
+// Nothing is read from disk; src is metadata.
+// To read and parse AsciiDoc, call [Load].
+func NewAsciiDocDocument(src string, meta *Metadata, next Document) *AsciiDocDocument {
+	return &AsciiDocDocument{
+		SourcePath: src,
+
+		deps: map[string]struct{}{
+			"public/style.css": {},
+		},
+		meta: meta,
+		next: next,
+	}
+}
+
+func (doc *AsciiDocDocument) DependsOn(src string) bool {
+	if _, ok := doc.deps[src]; ok {
+		return true
+	}
+	return doc.next.DependsOn(src)
+}
+
+// Load reads AsciiDoc from r and loads it into doc.
+//
+// Header attributes that name metadata,
+// such as :date: or :series-order:,
+// set it the same way Org's #+DATE: or #+TYPE: do.
+//
+// If called more than once, the last call wins.
+func (doc *AsciiDocDocument) Load(r io.Reader) error {
+	cfg := configuration.NewConfiguration(
+		configuration.WithFilename(doc.SourcePath),
+		configuration.WithHeaderFooter(false),
+	)
+	pre, err := parser.Preprocess(r, cfg)
+	if err != nil {
+		return fmt.Errorf("cannot preprocess AsciiDoc in %s: %w", doc.SourcePath, err)
+	}
+	adoc, err := parser.ParseDocument(bytes.NewBufferString(pre), cfg)
+	if err != nil {
+		return fmt.Errorf("cannot parse AsciiDoc in %s: %w", doc.SourcePath, err)
+	}
+
+	if header, _ := adoc.Header(); header != nil {
+		elements := header.Elements[:0]
+		for _, e := range header.Elements {
+			attr, ok := e.(*types.AttributeDeclaration)
+			if !ok {
+				elements = append(elements, e)
+				continue
+			}
+			if v, ok := attr.Value.(string); ok {
+				// AsciiDoc attribute names use hyphens where frontmatter uses underscores,
+				// as in :series-order:.
+				key := strings.ReplaceAll(attr.Name, "-", "_")
+				if err := doc.meta.setAttribute(key, v); err != nil {
+					return fmt.Errorf("cannot read :%s: of %s: %w", attr.Name, doc.SourcePath, err)
+				}
+			}
+			// Winter renders tables of contents itself,
+			// so AsciiDoc must not try to place one.
+			if attr.Name != types.AttrTableOfContents {
+				elements = append(elements, e)
+			}
+		}
+		header.Elements = elements
+	}
+
+	var body bytes.Buffer
+	adocMeta, err := renderer.Render(adoc, cfg, &body)
+	if err != nil {
+		return fmt.Errorf("cannot render AsciiDoc in %s: %w", doc.SourcePath, err)
+	}
+
+	var htm bytes.Buffer
+	// The document title is not part of the body,
+	// but the HTML document expects it as the first level-1 heading.
+	if adocMeta.Title != "" {
+		fmt.Fprintf(&htm, "<h1>%s</h1>\n", html.EscapeString(adocMeta.Title))
+	}
+	htm.Write(body.Bytes())
+	return doc.next.Load(&htm)
+}
+
+func (doc *AsciiDocDocument) Metadata() *Metadata {
+	return doc.meta
+}
+
+func (doc *AsciiDocDocument) Render(w io.Writer) error {
+	return doc.next.Render(w)
+}
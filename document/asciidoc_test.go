@@ -0,0 +1,65 @@
+package document // import "twos.dev/winter/document"
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestAsciiDoc(t *testing.T) {
+	src := filepath.Join("src", "test", "kiln.adoc")
+	meta := NewMetadata(src, filepath.Join("testdata", "templates"))
+	doc := NewAsciiDocDocument(src, meta, NewHTMLDocument(src, meta, nil, nil))
+	assert.NilError(t, doc.Load(strings.NewReader(`= Building a *Kiln*
+Jane Doe <jane@example.com>
+:date: 2024-01-02
+:type: post
+:filename: forge.html
+:series: Kilns
+:series-order: 2
+:toc: 3
+
+Start with link:bricks.adoc[bricks].
+
+== Bricks
+
+Bricks are *good*.
+
+[source,go]
+----
+package main
+----
+`)))
+
+	assert.Equal(t, meta.Title, "Building a Kiln")
+	assert.Equal(t, meta.CreatedAt, time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, meta.Kind, post)
+	assert.Equal(t, meta.WebPath, "/forge.html")
+	assert.Equal(t, meta.Series, "Kilns")
+	assert.Equal(t, meta.SeriesOrder, 2)
+	assert.Assert(t, meta.TOC)
+	assert.Equal(t, meta.TOCOptions.Max, 3)
+
+	var buf strings.Builder
+	assert.NilError(t, doc.Render(&buf))
+	for _, want := range []string{
+		`<a href="bricks.adoc">bricks</a>`,
+		`<h2 id="_bricks">Bricks`,
+		`<p>Bricks are <strong>good</strong>.</p>`,
+		`<pre tabindex="0" class="chroma">`,
+	} {
+		assert.Assert(t, strings.Contains(buf.String(), want), "missing %s in %s", want, buf.String())
+	}
+	assert.Assert(t, !strings.Contains(buf.String(), "<h1>"), buf.String())
+}
+
+func TestAsciiDocBadAttribute(t *testing.T) {
+	src := filepath.Join("src", "test", "bad.adoc")
+	meta := NewMetadata(src, filepath.Join("testdata", "templates"))
+	doc := NewAsciiDocDocument(src, meta, NewHTMLDocument(src, meta, nil, nil))
+	err := doc.Load(strings.NewReader("= Bad\n:date: yesterday\n\nHi.\n"))
+	assert.ErrorContains(t, err, ":date:")
+}
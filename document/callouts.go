@@ -0,0 +1,164 @@
+package document // import "twos.dev/winter/document"
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// calloutTmpl is the partial template that renders callouts,
+// given calloutVars.
+const calloutTmpl = "_callout.html.tmpl"
+
+// calloutKinds are the labels that turn a blockquote into a callout.
+var calloutKinds = map[string]struct{}{
+	"caution":   {},
+	"important": {},
+	"note":      {},
+	"tip":       {},
+	"warning":   {},
+}
+
+// defaultCallout renders a callout as an <aside> titled by its label.
+var defaultCallout = template.Must(template.New(calloutTmpl).Parse(
+	`<aside class="callout callout-{{ .Kind }}" role="note"><p class="callout-title">{{ .Title }}</p>{{ .Body }}</aside>`,
+))
+
+// calloutVars describe one blockquote turned into a callout.
+type calloutVars struct {
+	// Kind is the lowercase kind of the callout,
+	// such as note or warning.
+	Kind string
+	// Title is the label the callout was written with,
+	// without its colon,
+	// such as Note or Warning.
+	Title string
+	// Body is the content of the callout after its label.
+	Body template.HTML
+}
+
+// insertCallouts turns blockquotes that open with a bold label,
+// such as **Note:** in Markdown or *Note:* in Org,
+// into asides rendered by src/templates/_callout.html.tmpl,
+// or a plain <aside> with a class for the kind of callout if that template does not exist.
+// Labels are Note, Tip, Important, Warning, and Caution.
+//
+// For example,
+//
+//	<blockquote><p><strong>Warning:</strong> The kiln is hot.</p></blockquote>
+//
+// becomes
+//
+//	<aside class="callout callout-warning" role="note"><p class="callout-title">Warning</p><p>The kiln is hot.</p></aside>
+//
+// Sources stay plain blockquotes,
+// so they read the same wherever they are shown without Winter.
+func (doc *HTMLDocument) insertCallouts() error {
+	var tmpl *template.Template
+	for _, quote := range allOfTypes(doc.root, map[atom.Atom]struct{}{atom.Blockquote: {}}) {
+		title, ok := takeCalloutLabel(quote)
+		if !ok {
+			continue
+		}
+		if tmpl == nil {
+			var err error
+			if tmpl, err = doc.partialOr(calloutTmpl, defaultCallout); err != nil {
+				return err
+			}
+		}
+		var body bytes.Buffer
+		for child := quote.FirstChild; child != nil; child = child.NextSibling {
+			if err := html.Render(&body, child); err != nil {
+				return fmt.Errorf("cannot render callout in %s: %w", doc.meta.SourcePath, err)
+			}
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, calloutVars{
+			Kind:  strings.ToLower(title),
+			Title: title,
+			Body:  template.HTML(strings.TrimSpace(body.String())),
+		}); err != nil {
+			return fmt.Errorf("cannot execute %s for %s: %w", calloutTmpl, doc.meta.SourcePath, err)
+		}
+		nodes, err := html.ParseFragment(&buf, quote.Parent)
+		if err != nil {
+			return fmt.Errorf("cannot parse callout in %s: %w", doc.meta.SourcePath, err)
+		}
+		for _, n := range nodes {
+			quote.Parent.InsertBefore(n, quote)
+		}
+		quote.Parent.RemoveChild(quote)
+	}
+	return nil
+}
+
+// takeCalloutLabel removes the bold label that opens blockquote quote,
+// such as <strong>Note:</strong>,
+// and returns it without its colon.
+// A paragraph left empty is removed along with it.
+//
+// If quote does not open with a callout label,
+// it is left alone and ok is false.
+func takeCalloutLabel(quote *html.Node) (title string, ok bool) {
+	p := firstElementChild(quote)
+	if p == nil || p.DataAtom != atom.P {
+		return "", false
+	}
+	strong := p.FirstChild
+	for strong != nil && strong.Type == html.TextNode && strings.TrimSpace(strong.Data) == "" {
+		strong = strong.NextSibling
+	}
+	if strong == nil || (strong.DataAtom != atom.Strong && strong.DataAtom != atom.B) {
+		return "", false
+	}
+
+	// The colon may be inside the bold text or just after it,
+	// as in **Note:** or **Note**:.
+	label := strings.TrimSpace(text(strong))
+	after := strong.NextSibling
+	colonAfter := false
+	if !strings.HasSuffix(label, ":") {
+		if after == nil || after.Type != html.TextNode || !strings.HasPrefix(after.Data, ":") {
+			return "", false
+		}
+		colonAfter = true
+	}
+	title = strings.TrimSpace(strings.TrimSuffix(label, ":"))
+	if _, ok := calloutKinds[strings.ToLower(title)]; !ok {
+		return "", false
+	}
+
+	for p.FirstChild != strong {
+		p.RemoveChild(p.FirstChild)
+	}
+	p.RemoveChild(strong)
+	if after != nil && after.Type == html.TextNode {
+		if colonAfter {
+			after.Data = after.Data[1:]
+		}
+		after.Data = strings.TrimLeft(after.Data, " \t\n")
+		if after.Data == "" {
+			p.RemoveChild(after)
+		}
+	}
+	if p.FirstChild == nil {
+		quote.RemoveChild(p)
+	}
+	return title, true
+}
+
+// firstElementChild returns the first child of n that is an element,
+// skipping text and comments,
+// or nil if there is none.
+func firstElementChild(n *html.Node) *html.Node {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode {
+			return child
+		}
+	}
+	return nil
+}
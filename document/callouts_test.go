@@ -0,0 +1,73 @@
+package document // import "twos.dev/winter/document"
+
+import (
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestInsertCallouts(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		ext   string
+		input string
+		want  string
+	}{
+		{
+			name:  "HTML",
+			ext:   ".html",
+			input: `<blockquote><p><strong>Note:</strong> Cones melt.</p><p>Watch them.</p></blockquote>`,
+			want:  `<aside class="callout callout-note" role="note"><p class="callout-title">Note</p><p>Cones melt.</p><p>Watch them.</p></aside>`,
+		},
+		{
+			name:  "ColonOutsideLabel",
+			ext:   ".html",
+			input: `<blockquote><p><b>Tip</b>: Wear gloves.</p></blockquote>`,
+			want:  `<aside class="callout callout-tip" role="note"><p class="callout-title">Tip</p><p>Wear gloves.</p></aside>`,
+		},
+		{
+			name:  "LabelAlone",
+			ext:   ".html",
+			input: `<blockquote><p><strong>Warning:</strong></p><p>Hot.</p></blockquote>`,
+			want:  `<aside class="callout callout-warning" role="note"><p class="callout-title">Warning</p><p>Hot.</p></aside>`,
+		},
+		{
+			name:  "PlainQuote",
+			ext:   ".html",
+			input: `<blockquote><p><strong>Reader:</strong> Nice kiln.</p></blockquote>`,
+			want:  `<blockquote><p><strong>Reader:</strong> Nice kiln.</p></blockquote>`,
+		},
+		{
+			name:  "Markdown",
+			ext:   ".md",
+			input: "> **Warning:** The kiln is *hot*.",
+			want:  "<aside class=\"callout callout-warning\" role=\"note\"><p class=\"callout-title\">Warning</p><p>The kiln is <em>hot</em>.</p></aside>",
+		},
+		{
+			name:  "MarkdownAdmonition",
+			ext:   ".md",
+			input: "---\nmarkdown:\n  extensions:\n    admonitions: true\n---\n> [!CAUTION]\n> Unplug it.",
+			want:  "<aside class=\"callout callout-caution\" role=\"note\"><p class=\"callout-title\">Caution</p><p>Unplug it.</p></aside>",
+		},
+		{
+			name:  "MarkdownAdmonitionCode",
+			ext:   ".md",
+			input: "---\nmarkdown:\n  extensions:\n    admonitions: true\n---\n> [!NOTE]\n> ```\n> kiln --fire\n> ```",
+			want:  "<aside class=\"callout callout-note\" role=\"note\"><p class=\"callout-title\">Note</p><pre",
+		},
+		{
+			name:  "Org",
+			ext:   ".org",
+			input: "#+BEGIN_QUOTE\n*Important:* Vent the room.\n#+END_QUOTE",
+			want:  "<aside class=\"callout callout-important\" role=\"note\"><p class=\"callout-title\">Important</p><p>Vent the room.</p></aside>",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			doc := loadAs(t, test.ext, test.input, nil)
+			var buf strings.Builder
+			assert.NilError(t, doc.Render(&buf))
+			assert.Assert(t, strings.Contains(buf.String(), test.want), buf.String())
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/gorilla/feeds"
 	"gopkg.in/yaml.v3"
@@ -35,6 +36,14 @@ type Config struct {
 	// Description is the Description of the website.
 	// This is used as metadata for the RSS feed.
 	Description string `yaml:"description,omitempty"`
+	// Diagrams maps code block languages, such as dot,
+	// to the commands that render them into SVG at build time,
+	// such as ["dot", "-Tsvg"].
+	// Each command is given the code block on standard input
+	// and must write the SVG to standard output.
+	//
+	// Commands configured here take precedence over renderers registered with RegisterCodeRenderer.
+	Diagrams map[string][]string `yaml:"diagrams,omitempty"`
 	// Dist is the location the site will be built into,
 	// relative to the working directory.
 	// After a build, this directory is suitable for deployment to the web as a set of static files.
@@ -45,6 +54,38 @@ type Config struct {
 	//
 	// If blank, defaults to ./dist.
 	Dist string `yaml:"dist,omitempty"`
+	// At is the moment the build treats as the present when deciding which documents are scheduled or expired.
+	// Setting it reproduces a scheduled build exactly as it would have run at that time.
+	//
+	// If zero, the current time is used.
+	At time.Time `yaml:"-"`
+	// Footnotes configures how footnotes are displayed.
+	Footnotes struct {
+		// Sidenotes is a flag that moves footnotes from the end of each document
+		// to beside their references,
+		// where a stylesheet can show them in the margin.
+		// Feeds keep footnotes at the end.
+		Sidenotes bool `yaml:"sidenotes,omitempty"`
+	} `yaml:"footnotes,omitempty"`
+	// Future is a flag that lists documents dated in the future as if they were already published.
+	// Their pages are built either way.
+	Future bool `yaml:"future,omitempty"`
+	// Highlight holds the defaults for syntax highlighting code blocks,
+	// which code blocks can override with options such as {linenos=false}.
+	Highlight struct {
+		// LineNumbers is where code blocks show line numbers:
+		// "inline" beside each line,
+		// "table" in a separate column that is not selected along with the code,
+		// or "none".
+		// If blank, defaults to "inline".
+		LineNumbers string `yaml:"line_numbers,omitempty" jsonschema:"enum=inline,enum=table,enum=none"`
+		// Style is the name of the Chroma style that winter generate css uses when none is given.
+		// If blank, defaults to "dracula".
+		Style string `yaml:"style,omitempty"`
+		// TabWidth is the number of spaces each tab in a code block is displayed as.
+		// If zero, defaults to 2.
+		TabWidth int `yaml:"tab_width,omitempty"`
+	} `yaml:"highlight,omitempty"`
 	// Known helps the generated site follow the "Cool URIs don't change" rule
 	// by remembering certain facts about what the site looks like,
 	// and checking newly-generated sites against those facts.
@@ -57,6 +98,19 @@ type Config struct {
 		// If unset, defaults to src/uris.txt.
 		URIs string `yaml:"urls,omitempty"`
 	} `yaml:"known,omitempty"`
+	// Markdown configures how Markdown documents are parsed.
+	// Documents can override it in their frontmatter.
+	Markdown MarkdownOptions `yaml:"markdown,omitempty"`
+	// Math configures how LaTeX math is displayed.
+	Math struct {
+		// Render is a flag that converts math into MathML at build time,
+		// so it displays without JavaScript, including in feeds.
+		// If false, math is left as TeX for a client-side library such as KaTeX.
+		Render bool `yaml:"render,omitempty"`
+		// Macros maps the names of custom TeX commands, without their backslash, such as R,
+		// to their definitions, such as \mathbb{R}.
+		Macros map[string]string `yaml:"macros,omitempty"`
+	} `yaml:"math,omitempty"`
 	// Name is the name of the website.
 	// This is used in various places in and out of templates.
 	Name string `yaml:"name,omitempty"`
@@ -66,7 +120,17 @@ type Config struct {
 	//
 	// Gear is used by Winter when processing photos to display photograph information,
 	// and provide links to purchase gear used in its creation.
-	Gear       []Gear `yaml:"gear,omitempty"`
+	Gear []Gear `yaml:"gear,omitempty"`
+	// Headings configures the anchors given to headings.
+	Headings struct {
+		// Links is a flag that adds a link to itself to every heading,
+		// so readers can copy a link to any section.
+		// Documents with a table of contents always have them,
+		// along with a link back up to the table of contents.
+		Links bool `yaml:"links,omitempty"`
+		// Slug holds the rules for turning heading text into heading IDs.
+		Slug SlugRules `yaml:"slug,omitempty"`
+	} `yaml:"headings,omitempty"`
 	Production struct {
 		// URL is the base URL you will connect to to view your deployed website
 		// (e.g. twos.dev or one.twos.dev or twos.dev:6667).
@@ -75,19 +139,73 @@ type Config struct {
 		// Must not be blank.
 		URL string `yaml:"url,omitempty"`
 	} `yaml:"production,omitempty"`
+	// PreviewLength is the maximum length, in characters,
+	// of the previews Winter generates for documents that don't specify one.
+	// Previews are cut at the end of a sentence or word.
+	// If zero, defaults to 200.
+	PreviewLength int `yaml:"preview_length,omitempty"`
 	// PurchaseURLs maps image source paths relative to src/ to external pages
 	// where those images can be purchased. A configured URL overrides the
 	// image's embedded XMP Licensor URL.
 	//
 	// A matching URL is exposed to templates as the image's PurchaseURL field.
 	PurchaseURLs map[string]string `yaml:"purchase_urls,omitempty"`
+	// Serving is a flag that the build is being served locally by winter serve,
+	// rather than built for deployment.
+	// Template functions such as absURL use it to link to development.url instead of production.url.
+	Serving bool `yaml:"-"`
 	// Since is the year the website was established,
 	// whether through Winter or otherwise.
 	// This is used as metadata for the RSS feed,
 	// and as a copyright notice when needed.
 	Since int `yaml:"since,omitempty"`
+	// TOC holds the defaults for tables of contents,
+	// which documents can override in their frontmatter.
+	TOC struct {
+		// Min is the level of the highest headings listed,
+		// where 2 means <h2>.
+		// If zero, defaults to 2.
+		Min int `yaml:"min,omitempty"`
+		// Max is the level of the deepest headings listed,
+		// where 2 means <h2>.
+		// If zero, defaults to 5.
+		Max int `yaml:"max,omitempty"`
+		// Manual is a flag that leaves tables of contents out of document bodies,
+		// so layout templates can render them from .TOCOptions wherever they like.
+		Manual bool `yaml:"manual,omitempty"`
+	} `yaml:"toc,omitempty"`
 	// Src is an additional list of directories to search for source files beyond ./src.
 	Src []string `yaml:"srca,omitempty"`
+	// WordsPerMinute is the reading speed used to estimate how long each document takes to read.
+	// If zero, defaults to 200.
+	WordsPerMinute int `yaml:"words_per_minute,omitempty"`
+}
+
+// SlugRules holds the rules for turning text into slugs,
+// such as the IDs of headings.
+//
+// By default, a slug is the lowercase letters and digits of the text,
+// with any run of other characters replaced by a single hyphen.
+// For example, "Fire & Heat" becomes "fire-heat".
+type SlugRules struct {
+	// ASCII is a flag that removes accents from letters,
+	// then removes any characters that still aren't ASCII.
+	// For example, "Café" becomes "cafe".
+	ASCII bool `yaml:"ascii,omitempty"`
+	// KeepCase is a flag that preserves uppercase letters.
+	KeepCase bool `yaml:"keep_case,omitempty"`
+	// Separator replaces runs of characters that aren't letters or digits.
+	// If blank, defaults to "-".
+	Separator string `yaml:"separator,omitempty"`
+}
+
+// MarkdownOptions configures how Markdown is parsed.
+type MarkdownOptions struct {
+	// Extensions maps the names of Markdown extensions,
+	// such as definition_lists or smartypants,
+	// to whether they are enabled.
+	// Extensions not listed keep their defaults.
+	Extensions map[string]bool `yaml:"extensions,omitempty"`
 }
 
 type Gear struct {
@@ -189,6 +307,15 @@ func (c *Config) GearByString(make, model string) (g *Gear, ok bool) {
 	return nil, false
 }
 
+// Now returns the moment the build treats as the present.
+// It is c.At if set, or the current time otherwise.
+func (c *Config) Now() time.Time {
+	if c == nil || c.At.IsZero() {
+		return time.Now()
+	}
+	return c.At
+}
+
 // SourcePaths returns all paths that should be searched for soruce files.
 // It is equivalent to "src" plus c.Src.
 func (c *Config) SourcePaths() []string {
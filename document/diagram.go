@@ -0,0 +1,187 @@
+package document // import "twos.dev/winter/document"
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/adrg/xdg"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// A CodeRenderer renders the source of a code block,
+// such as a Graphviz graph,
+// into HTML to display in its place,
+// such as an inline SVG diagram.
+type CodeRenderer func(src []byte) ([]byte, error)
+
+// registeredCodeRenderer is a code renderer registered with [RegisterCodeRenderer].
+type registeredCodeRenderer struct {
+	render  CodeRenderer
+	version string
+}
+
+var (
+	codeRenderersMu sync.RWMutex
+	codeRenderers   = map[string]registeredCodeRenderer{}
+)
+
+// RegisterCodeRenderer makes r render every code block in the language lang,
+// such as mermaid or pikchr.
+// It is meant for renderers written in Go;
+// renderers that are external commands can instead be configured in winter.yml.
+//
+// Output is cached across builds by version,
+// which should change whenever r would render the same code differently,
+// such as when r is upgraded,
+// so diagrams rendered by an older r are rendered again.
+//
+// Registering a renderer for a language replaces any previously registered for it.
+func RegisterCodeRenderer(lang, version string, r CodeRenderer) {
+	codeRenderersMu.Lock()
+	defer codeRenderersMu.Unlock()
+	codeRenderers[lang] = registeredCodeRenderer{render: r, version: version}
+}
+
+// codeRenderer returns the renderer for code blocks in the language lang,
+// and a string identifying it for caching,
+// or nil if code in that language is only highlighted.
+func (doc *HTMLDocument) codeRenderer(lang string) (CodeRenderer, string) {
+	if doc.s != nil && doc.s.cfg != nil {
+		if args, ok := doc.s.cfg.Diagrams[lang]; ok && len(args) > 0 {
+			return commandRenderer(args), commandID(args)
+		}
+	}
+	codeRenderersMu.RLock()
+	defer codeRenderersMu.RUnlock()
+	if r, ok := codeRenderers[lang]; ok {
+		return r.render, "registered\x00" + r.version
+	}
+	return nil, ""
+}
+
+// commandID returns a string identifying the command args for caching its output.
+// It includes the path the command resolves to and when that file last changed,
+// so upgrading the command renders its diagrams again.
+func commandID(args []string) string {
+	id := strings.Join(args, "\x00")
+	path, err := exec.LookPath(args[0])
+	if err != nil {
+		return id
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return id
+	}
+	return fmt.Sprintf("%s\x00%s\x00%d\x00%d", id, path, stat.ModTime().UnixNano(), stat.Size())
+}
+
+// commandRenderer returns a renderer that runs the command args,
+// piping the code block to its standard input and reading SVG from its standard output.
+func commandRenderer(args []string) CodeRenderer {
+	return func(src []byte) ([]byte, error) {
+		var stdout, stderr bytes.Buffer
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdin = bytes.NewReader(src)
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("cannot run %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+		}
+		out := stdout.Bytes()
+		// Drop any XML declaration or doctype, which are invalid inside HTML.
+		if i := bytes.Index(out, []byte("<svg")); i > 0 {
+			out = out[i:]
+		}
+		return out, nil
+	}
+}
+
+// renderDiagrams replaces every code block in a language with a renderer,
+// such as a Graphviz graph,
+// with the renderer's output.
+// The code block itself is kept in a collapsed <details> element,
+// so the source is still readable where the output cannot be shown.
+//
+// Output is cached by the content of the code block,
+// so unchanged diagrams are not rendered again on the next build.
+func (doc *HTMLDocument) renderDiagrams() error {
+	for code := range codeBlocks(doc.root) {
+		lang := lang(code)
+		if lang == "" {
+			continue
+		}
+		r, id := doc.codeRenderer(lang)
+		if r == nil {
+			continue
+		}
+		src := text(code)
+		out, err := renderCached(r, lang, id, []byte(src))
+		if err != nil {
+			return fmt.Errorf("cannot render %s diagram in %s: %w", lang, doc.meta.SourcePath, err)
+		}
+
+		pre := code.Parent
+		diagram := &html.Node{
+			Type:     html.ElementNode,
+			DataAtom: atom.Div,
+			Data:     atom.Div.String(),
+			Attr:     []html.Attribute{{Key: atom.Class.String(), Val: "diagram diagram-" + lang}},
+		}
+		nodes, err := html.ParseFragment(bytes.NewReader(out), diagram)
+		if err != nil {
+			return fmt.Errorf("cannot parse %s diagram in %s: %w", lang, doc.meta.SourcePath, err)
+		}
+		for _, n := range nodes {
+			diagram.AppendChild(n)
+		}
+		details := &html.Node{Type: html.ElementNode, DataAtom: atom.Details, Data: atom.Details.String()}
+		summary := &html.Node{Type: html.ElementNode, DataAtom: atom.Summary, Data: atom.Summary.String()}
+		summary.AppendChild(&html.Node{Type: html.TextNode, Data: "Source"})
+		details.AppendChild(summary)
+
+		pre.Parent.InsertBefore(diagram, pre)
+		pre.Parent.RemoveChild(pre)
+		details.AppendChild(pre)
+		diagram.AppendChild(details)
+	}
+	return nil
+}
+
+// renderCached renders src with r,
+// reusing the output of an earlier build if the same renderer has rendered the same source before.
+// To empty the cache, run winter clean.
+func renderCached(r CodeRenderer, lang, id string, src []byte) ([]byte, error) {
+	sum := sha256.New()
+	fmt.Fprintf(sum, "%s\x00%s\x00", lang, id)
+	sum.Write(src)
+	cachePath, err := xdg.CacheFile(filepath.Join(AppName, "generated", "diagrams", hex.EncodeToString(sum.Sum(nil))+".html"))
+	if err != nil {
+		return nil, fmt.Errorf("cannot find Winter cache: %w", err)
+	}
+	if out, err := os.ReadFile(cachePath); err == nil {
+		return out, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("cannot read cached diagram at %q: %w", cachePath, err)
+	}
+
+	out, err := r(src)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(cachePath, out, 0o644); err != nil {
+		return nil, fmt.Errorf("cannot cache diagram at %q: %w", cachePath, err)
+	}
+	return out, nil
+}
@@ -0,0 +1,96 @@
+package document // import "twos.dev/winter/document"
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adrg/xdg"
+	"gotest.tools/v3/assert"
+)
+
+func TestRenderDiagrams(t *testing.T) {
+	t.Cleanup(xdg.Reload)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	xdg.Reload()
+
+	calls := 0
+	RegisterCodeRenderer("shout", "1", func(src []byte) ([]byte, error) {
+		calls++
+		return []byte("<svg><text>" + strings.ToUpper(string(src)) + "</text></svg>"), nil
+	})
+	t.Cleanup(func() {
+		codeRenderersMu.Lock()
+		defer codeRenderersMu.Unlock()
+		delete(codeRenderers, "shout")
+	})
+	s := &Substructure{cfg: &Config{}}
+	s.cfg.Diagrams = map[string][]string{
+		"wrap": {"sh", "-c", `printf '<?xml version="1.0"?>\n<svg><text>'; cat; printf '</text></svg>'`},
+		"fail": {"sh", "-c", "echo bad diagram >&2; exit 1"},
+	}
+	render := func(t *testing.T, input string) (string, error) {
+		src := filepath.Join("src", "test", "diagram.md")
+		doc := NewHTMLDocument(src, NewMetadata(src, filepath.Join("testdata", "templates")), s, nil)
+		if err := doc.Load(strings.NewReader(input)); err != nil {
+			return "", err
+		}
+		var buf strings.Builder
+		err := doc.Render(&buf)
+		return buf.String(), err
+	}
+
+	t.Run("Registered", func(t *testing.T) {
+		out, err := render(t, `<pre><code class="language-shout">hello</code></pre>`)
+		assert.NilError(t, err)
+		assert.Assert(t, strings.Contains(out, `<div class="diagram diagram-shout"><svg><text>HELLO</text></svg><details><summary>Source</summary><pre`), out)
+		assert.Equal(t, calls, 1)
+	})
+
+	t.Run("Cached", func(t *testing.T) {
+		out, err := render(t, `<pre><code class="language-shout">hello</code></pre>`)
+		assert.NilError(t, err)
+		assert.Assert(t, strings.Contains(out, `<text>HELLO</text>`), out)
+		assert.Equal(t, calls, 1)
+	})
+
+	t.Run("NewVersion", func(t *testing.T) {
+		RegisterCodeRenderer("shout", "2", func(src []byte) ([]byte, error) {
+			return nil, errors.New("rendered again")
+		})
+		_, err := render(t, `<pre><code class="language-shout">hello</code></pre>`)
+		assert.ErrorContains(t, err, "rendered again")
+	})
+
+	t.Run("Command", func(t *testing.T) {
+		out, err := render(t, `<pre><code class="language-wrap">a -&gt; b</code></pre>`)
+		assert.NilError(t, err)
+		assert.Assert(t, strings.Contains(out, `<div class="diagram diagram-wrap"><svg><text>a -&gt; b</text></svg><details>`), out)
+		assert.Assert(t, !strings.Contains(out, `<?xml`), out)
+	})
+
+	t.Run("Failure", func(t *testing.T) {
+		_, err := render(t, `<pre><code class="language-fail">a</code></pre>`)
+		assert.ErrorContains(t, err, "bad diagram")
+	})
+
+	t.Run("Unregistered", func(t *testing.T) {
+		out, err := render(t, `<pre><code class="language-go">package main</code></pre>`)
+		assert.NilError(t, err)
+		assert.Assert(t, !strings.Contains(out, "diagram"), out)
+	})
+}
+
+func TestCommandIDChangesWithCommand(t *testing.T) {
+	dot := filepath.Join(t.TempDir(), "dot")
+	assert.NilError(t, os.WriteFile(dot, []byte("#!/bin/sh\ncat\n"), 0o755))
+	before := commandID([]string{dot, "-Tsvg"})
+	assert.Equal(t, commandID([]string{dot, "-Tsvg"}), before)
+
+	later := time.Now().Add(time.Hour)
+	assert.NilError(t, os.Chtimes(dot, later, later))
+	assert.Assert(t, commandID([]string{dot, "-Tsvg"}) != before)
+}
@@ -24,7 +24,9 @@ const (
 	tocReturn = `
 <span style="margin-left:0.5em">
 	<a href="#{{.Anchor}}" style="text-decoration:none">#</a>
+	{{- if .TOC }}
 	<a href="#toc" style="text-decoration:none">&uarr;</a>
+	{{- end }}
 </span>
 `
 )
@@ -14,7 +14,7 @@ import (
 const favicon = "/favicon.ico"
 
 func (s *Substructure) writefeed() error {
-	now := time.Now()
+	now := s.cfg.Now()
 	siteURL := url.URL{Scheme: "https", Host: s.cfg.Production.URL}
 
 	feed := feeds.Feed{
@@ -45,13 +45,19 @@ func (s *Substructure) writefeed() error {
 		if doc.Metadata().Kind != post {
 			continue
 		}
+		if !doc.Metadata().ListedAt(now, s.cfg.Future) {
+			continue
+		}
 		var buf bytes.Buffer
 		layout := doc.Metadata().Layout
 		doc.Metadata().Layout = ""
-		if err := doc.Render(&buf); err != nil {
+		doc.Metadata().feed = true
+		err := doc.Render(&buf)
+		doc.Metadata().Layout = layout
+		doc.Metadata().feed = false
+		if err != nil {
 			return err
 		}
-		doc.Metadata().Layout = layout
 		bodyStr := buf.String()
 
 		bodyStr = strings.ReplaceAll(bodyStr, "&#34;", "\"")
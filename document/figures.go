@@ -0,0 +1,120 @@
+package document // import "twos.dev/winter/document"
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// galleryClass is the class given to figures of more than one image.
+const galleryClass = "gallery"
+
+// insertFigures wraps every paragraph containing only images in a <figure>,
+// and an all-italic paragraph immediately after one in a <figcaption> inside it.
+// A figure of more than one image is a gallery,
+// and gets the gallery class so it can be laid out as a grid.
+//
+// For example,
+//
+//	<p><img src="cat.jpg"><img src="dog.jpg"></p>
+//	<p><em>My cat and dog.</em></p>
+//
+// becomes
+//
+//	<figure class="gallery"><img src="cat.jpg"><img src="dog.jpg"><figcaption>My cat and dog.</figcaption></figure>
+func (doc *HTMLDocument) insertFigures() {
+	for _, p := range allOfTypes(doc.root, map[atom.Atom]struct{}{atom.P: {}}) {
+		if p.Parent == nil {
+			// Already moved into a figure as a caption.
+			continue
+		}
+		images := imagesOnly(p)
+		if len(images) == 0 {
+			continue
+		}
+		figure := &html.Node{Type: html.ElementNode, DataAtom: atom.Figure, Data: atom.Figure.String()}
+		if len(images) > 1 {
+			setAttr(figure, atom.Class, galleryClass)
+		}
+		p.Parent.InsertBefore(figure, p)
+		for _, im := range images {
+			p.RemoveChild(im)
+			figure.AppendChild(im)
+		}
+
+		if next := nextElement(p); next != nil {
+			if em := italicOnly(next); em != nil {
+				caption := &html.Node{Type: html.ElementNode, DataAtom: atom.Figcaption, Data: atom.Figcaption.String()}
+				for em.FirstChild != nil {
+					child := em.FirstChild
+					em.RemoveChild(child)
+					caption.AppendChild(child)
+				}
+				figure.AppendChild(caption)
+				next.Parent.RemoveChild(next)
+			}
+		}
+		p.Parent.RemoveChild(p)
+	}
+}
+
+// imagesOnly returns the images in p,
+// each possibly wrapped in a link,
+// if p contains nothing else but whitespace and line breaks.
+// Otherwise it returns nil.
+func imagesOnly(p *html.Node) (images []*html.Node) {
+	for child := p.FirstChild; child != nil; child = child.NextSibling {
+		switch {
+		case child.Type == html.TextNode && strings.TrimSpace(child.Data) == "":
+		case child.DataAtom == atom.Br:
+		case isImage(child):
+			images = append(images, child)
+		case child.DataAtom == atom.A && child.FirstChild != nil && child.FirstChild == child.LastChild && isImage(child.FirstChild):
+			images = append(images, child)
+		default:
+			return nil
+		}
+	}
+	return images
+}
+
+// isImage reports whether n is an image or video.
+func isImage(n *html.Node) bool {
+	switch n.DataAtom {
+	case atom.Img, atom.Picture, atom.Video:
+		return true
+	}
+	return false
+}
+
+// italicOnly returns the <em> or <i> element that is all of paragraph p's content,
+// or nil if p is not a paragraph of only italic text.
+func italicOnly(p *html.Node) *html.Node {
+	if p.DataAtom != atom.P {
+		return nil
+	}
+	var em *html.Node
+	for child := p.FirstChild; child != nil; child = child.NextSibling {
+		switch {
+		case child.Type == html.TextNode && strings.TrimSpace(child.Data) == "":
+		case em == nil && (child.DataAtom == atom.Em || child.DataAtom == atom.I):
+			em = child
+		default:
+			return nil
+		}
+	}
+	return em
+}
+
+// nextElement returns the element following n among its siblings,
+// skipping text and comments,
+// or nil if there is none.
+func nextElement(n *html.Node) *html.Node {
+	for sib := n.NextSibling; sib != nil; sib = sib.NextSibling {
+		if sib.Type == html.ElementNode {
+			return sib
+		}
+	}
+	return nil
+}
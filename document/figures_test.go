@@ -0,0 +1,72 @@
+package document // import "twos.dev/winter/document"
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestInsertFigures(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		ext   string
+		input string
+		want  string
+	}{
+		{
+			name:  "HTML",
+			ext:   ".html",
+			input: `<p><img src="/cat.jpg" alt="Cat"/></p><p><em>My cat.</em></p>`,
+			want:  `<figure><img src="/cat.jpg" alt="Cat"/><figcaption>My cat.</figcaption></figure>`,
+		},
+		{
+			name:  "Uncaptioned",
+			ext:   ".html",
+			input: `<p><img src="/cat.jpg" alt="Cat"/></p><p>My <em>cat</em>.</p>`,
+			want:  `<figure><img src="/cat.jpg" alt="Cat"/></figure><p>My <em>cat</em>.</p>`,
+		},
+		{
+			name:  "Linked",
+			ext:   ".html",
+			input: `<p><a href="/cat.html"><img src="/cat.jpg" alt="Cat"/></a></p>`,
+			want:  `<figure><a href="/cat.html"><img src="/cat.jpg" alt="Cat"/></a></figure>`,
+		},
+		{
+			name:  "Inline",
+			ext:   ".html",
+			input: `<p>Look: <img src="/cat.jpg" alt="Cat"/></p>`,
+			want:  `<p>Look: <img src="/cat.jpg" alt="Cat"/></p>`,
+		},
+		{
+			name:  "MarkdownGallery",
+			ext:   ".md",
+			input: "![Cat](/cat.jpg)\n![Dog](/dog.jpg)\n\n_My cat and dog._",
+			want:  "<figure class=\"gallery\"><img src=\"/cat.jpg\" alt=\"Cat\"/><img src=\"/dog.jpg\" alt=\"Dog\"/><figcaption>My cat and dog.</figcaption></figure>",
+		},
+		{
+			name:  "Org",
+			ext:   ".org",
+			input: "[[/cat.jpg]]\n\n/My cat./",
+			want:  `<figcaption>My cat.</figcaption></figure>`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			src := filepath.Join("src", "test", "figures"+test.ext)
+			meta := NewMetadata(src, filepath.Join("testdata", "templates"))
+			htm := NewHTMLDocument(src, meta, nil, nil)
+			var doc Document = htm
+			switch test.ext {
+			case ".md":
+				doc = NewMarkdownDocument(src, meta, map[Document]struct{}{htm: {}})
+			case ".org":
+				doc = NewOrgDocument(src, meta, htm)
+			}
+			assert.NilError(t, doc.Load(strings.NewReader(test.input)))
+			var buf strings.Builder
+			assert.NilError(t, doc.Render(&buf))
+			assert.Assert(t, strings.Contains(buf.String(), test.want), buf.String())
+		})
+	}
+}
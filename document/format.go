@@ -0,0 +1,152 @@
+package document // import "twos.dev/winter/document"
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A Format is a kind of source file that Winter builds into a web page,
+// such as Markdown or Org.
+type Format struct {
+	// Extensions are the filename suffixes of source files in the format,
+	// including the leading dot,
+	// such as .md or .html.tmpl.
+	Extensions []string
+	// New returns a document that loads the source file at src,
+	// described by meta,
+	// and renders it as HTML into html.
+	//
+	// html massages what it is given and renders it into its layout.
+	// The returned document may also render into documents of its own,
+	// such as a Gemini version of the page.
+	// It must read all it needs from the source file in Load,
+	// since the file is closed before the document is rendered.
+	New func(src string, meta *Metadata, html Document) Document
+	// Split optionally returns the source paths of the documents in the source file at src,
+	// for formats in which one file can hold several documents.
+	// Each is src followed by :: and a name for the document unique within the file,
+	// and is given to New in place of src.
+	//
+	// If Split is nil or returns nothing,
+	// the file is a single document.
+	Split func(src string) ([]string, error)
+}
+
+// subdocumentSep separates the path to a source file from the name of one of several documents in it,
+// as in src/cold/notes.org::kiln.
+const subdocumentSep = "::"
+
+var (
+	formatsMu sync.RWMutex
+	formats   = map[string]Format{
+		"asciidoc": {
+			Extensions: []string{asciiDocSuffix, ".asciidoc"},
+			New: func(src string, meta *Metadata, html Document) Document {
+				return NewAsciiDocDocument(src, meta, html)
+			},
+		},
+		"html": {
+			Extensions: []string{htmlSuffix},
+			New:        newHTMLFormatDocument,
+		},
+		"jupyter": {
+			Extensions: []string{jupyterSuffix},
+			New: func(src string, meta *Metadata, html Document) Document {
+				return NewJupyterDocument(src, meta, html)
+			},
+		},
+		"markdown": {
+			Extensions: []string{markdownSuffix},
+			New: func(src string, meta *Metadata, html Document) Document {
+				return NewMarkdownDocument(src, meta, map[Document]struct{}{
+					html:                         {},
+					NewGeminiDocument(src, meta): {},
+				})
+			},
+		},
+		"org": {
+			Extensions: []string{orgSuffix},
+			New: func(src string, meta *Metadata, html Document) Document {
+				return NewOrgDocument(src, meta, html)
+			},
+			Split: splitOrg,
+		},
+		"template": {
+			Extensions: []string{templateSuffix},
+			New:        newHTMLFormatDocument,
+		},
+	}
+)
+
+// RegisterFormat makes Winter build source files in the format f,
+// such as AsciiDoc or reStructuredText,
+// alongside the formats it supports out of the box.
+// Call it before creating a [Substructure].
+//
+// Registering a format under a name replaces any previously registered under it,
+// including the built-in html, markdown, org, and template formats.
+func RegisterFormat(name string, f Format) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+	formats[name] = f
+}
+
+// formatOf returns the format of the source file at src.
+// If more than one format claims src,
+// the one with the longest matching extension wins,
+// so that .html.tmpl files are templates rather than HTML.
+//
+// If no format claims src, ok is false.
+func formatOf(src string) (f Format, ok bool) {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	var longest int
+	// Sort names so that ties are broken the same way every time.
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, ext := range formats[name].Extensions {
+			if len(ext) > longest && strings.HasSuffix(src, ext) {
+				f, ok, longest = formats[name], true, len(ext)
+			}
+		}
+	}
+	return f, ok
+}
+
+// sourceFile returns the path to the file that the document with source path src is read from,
+// which is src itself unless the file holds several documents.
+func sourceFile(src string) string {
+	file, _, _ := strings.Cut(src, subdocumentSep)
+	return file
+}
+
+// isTextDocExt returns whether ext,
+// such as .md,
+// is the extension of a source file that is built into a web page.
+func isTextDocExt(ext string) bool {
+	if _, ok := textDocExts[ext]; ok {
+		return true
+	}
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	for _, f := range formats {
+		for _, e := range f.Extensions {
+			if ext != "" && path.Ext(e) == ext {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// newHTMLFormatDocument returns html as is,
+// for source files that are already HTML.
+func newHTMLFormatDocument(_ string, _ *Metadata, html Document) Document {
+	return html
+}
@@ -0,0 +1,98 @@
+package document // import "twos.dev/winter/document"
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+// plainTextDocument is a document in a toy format used to test [RegisterFormat].
+// It renders each source file as a single paragraph.
+type plainTextDocument struct {
+	meta *Metadata
+	next Document
+}
+
+func (doc *plainTextDocument) DependsOn(src string) bool { return doc.next.DependsOn(src) }
+func (doc *plainTextDocument) Metadata() *Metadata       { return doc.meta }
+func (doc *plainTextDocument) Render(w io.Writer) error  { return doc.next.Render(w) }
+
+func (doc *plainTextDocument) Load(r io.Reader) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return doc.next.Load(bytes.NewBufferString(fmt.Sprintf("<p>%s</p>", html.EscapeString(string(b)))))
+}
+
+func TestRegisterFormat(t *testing.T) {
+	RegisterFormat("plaintext", Format{
+		Extensions: []string{".txt"},
+		New: func(src string, meta *Metadata, html Document) Document {
+			return &plainTextDocument{meta: meta, next: html}
+		},
+	})
+	t.Cleanup(func() {
+		formatsMu.Lock()
+		defer formatsMu.Unlock()
+		delete(formats, "plaintext")
+	})
+
+	tmp := t.TempDir()
+	cwd, err := os.Getwd()
+	assert.NilError(t, err)
+	assert.NilError(t, os.Chdir(tmp))
+	t.Cleanup(func() {
+		_ = os.Chdir(cwd)
+	})
+	for _, f := range []string{"notes.txt", "post.md", "page.html.tmpl", "style.css"} {
+		p := filepath.Join("src", "cold", f)
+		assert.NilError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		assert.NilError(t, os.WriteFile(p, []byte("Hi & bye."), 0o644))
+	}
+
+	s := &Substructure{cfg: &Config{}, docs: &documents{}}
+	assert.NilError(t, s.discoverDocuments("src"))
+
+	for src, want := range map[string]string{
+		"notes.txt":      "*document.plainTextDocument",
+		"post.md":        "*document.MarkdownDocument",
+		"page.html.tmpl": "*document.HTMLDocument",
+	} {
+		doc, ok := s.DocBySourcePath(filepath.Join("src", "cold", src))
+		assert.Assert(t, ok, "%s was not discovered", src)
+		assert.Equal(t, fmt.Sprintf("%T", doc), want)
+	}
+	_, ok := s.DocBySourcePath(filepath.Join("src", "cold", "style.css"))
+	assert.Assert(t, !ok)
+	// Only formats that render gemtext get Gemini files.
+	for src, want := range map[string]string{
+		"notes.txt":      "",
+		"post.md":        "post.gmi",
+		"page.html.tmpl": "",
+	} {
+		doc, _ := s.DocBySourcePath(filepath.Join("src", "cold", src))
+		assert.Equal(t, doc.Metadata().GeminiPath, want, src)
+	}
+
+	src := filepath.Join("src", "cold", "notes.txt")
+	f, ok := formatOf(src)
+	assert.Assert(t, ok)
+	meta := NewMetadata(src, filepath.Join("testdata", "templates"))
+	assert.Equal(t, meta.WebPath, "notes.html")
+	doc := f.New(src, meta, NewHTMLDocument(src, meta, nil, nil))
+	assert.NilError(t, doc.Load(strings.NewReader("Hi & bye.")))
+	var buf strings.Builder
+	assert.NilError(t, doc.Render(&buf))
+	assert.Assert(t, strings.Contains(buf.String(), "<p>Hi &amp; bye.</p>"), buf.String())
+
+	_, _, ok = sourceLinkPath("/notes.txt")
+	assert.Assert(t, ok, "links to registered formats should resolve to their pages")
+}
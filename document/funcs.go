@@ -0,0 +1,402 @@
+package document // import "twos.dev/winter/document"
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"math"
+	"net/url"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// helpers returns the functions templates have available for working with dates, strings, URLs, and collections.
+// cfg may be nil,
+// in which case defaults are used.
+//
+// They are documented for users in the Functions section of the README.
+func helpers(cfg *Config) template.FuncMap {
+	now := cfg.Now()
+	return template.FuncMap{
+		"isoDate":      isoDate,
+		"rfc3339":      rfc3339,
+		"relativeDate": func(t time.Time) string { return relativeDate(t, now) },
+
+		"slugify":     func(s any) string { return slugify(toString(s)) },
+		"truncate":    func(length int, s any) string { return truncate(toString(s), length) },
+		"markdownify": func(s any) (template.HTML, error) { return markdownify(cfg, toString(s)) },
+		"plainify":    plainify,
+
+		"absURL": func(p any) (string, error) { return absURL(cfg, toString(p)) },
+
+		"first":   first,
+		"last":    last,
+		"reverse": reverse,
+		"groupBy": groupBy,
+		"sortBy":  sortBy,
+
+		"safeHTML": func(s any) template.HTML { return template.HTML(toString(s)) },
+		"safeJS":   func(s any) template.JS { return template.JS(toString(s)) },
+		"safeCSS":  func(s any) template.CSS { return template.CSS(toString(s)) },
+		"safeURL":  func(s any) template.URL { return template.URL(toString(s)) },
+	}
+}
+
+// toString returns v as a string,
+// so template functions can take strings and typed strings such as [template.HTML] alike.
+func toString(v any) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// isoDate formats t as an ISO 8601 date,
+// such as 2024-03-15,
+// or returns an empty string if t is zero.
+func isoDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.DateOnly)
+}
+
+// rfc3339 formats t as an RFC 3339 timestamp,
+// such as 2024-03-15T09:30:00Z,
+// or returns an empty string if t is zero.
+func rfc3339(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// relativeDate describes t relative to now in words,
+// such as "3 days ago" or "in 2 weeks",
+// or returns an empty string if t is zero.
+// Anything within a minute of now is "just now".
+func relativeDate(t, now time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	d := now.Sub(t)
+	future := d < 0
+	if future {
+		d = -d
+	}
+	if d < time.Minute {
+		return "just now"
+	}
+	var n int
+	var unit string
+	switch day := 24 * time.Hour; {
+	case d < time.Hour:
+		n, unit = int(d/time.Minute), "minute"
+	case d < day:
+		n, unit = int(d/time.Hour), "hour"
+	case d < 7*day:
+		n, unit = int(d/day), "day"
+	case d < 30*day:
+		n, unit = int(d/(7*day)), "week"
+	case d < 365*day:
+		n, unit = int(d/(30*day)), "month"
+	default:
+		n, unit = int(d/(365*day)), "year"
+	}
+	if n != 1 {
+		unit += "s"
+	}
+	if future {
+		return fmt.Sprintf("in %d %s", n, unit)
+	}
+	return fmt.Sprintf("%d %s ago", n, unit)
+}
+
+// markdownify renders s from Markdown into HTML,
+// using the Markdown extensions enabled for the site by cfg.
+// If the result is a single paragraph,
+// its <p> tags are dropped so it can sit inside other elements.
+func markdownify(cfg *Config, s string) (template.HTML, error) {
+	exts, err := enabledMarkdownExtensions(cfg, nil)
+	if err != nil {
+		return "", fmt.Errorf("cannot markdownify %q: %w", s, err)
+	}
+	b := bytes.TrimSpace(renderMarkdown([]byte(s), exts))
+	if inner, ok := bytes.CutPrefix(b, []byte("<p>")); ok {
+		if inner, ok := bytes.CutSuffix(inner, []byte("</p>")); ok && !bytes.Contains(inner, []byte("<p>")) {
+			b = inner
+		}
+	}
+	return template.HTML(b), nil
+}
+
+// plainify returns the text of s with all HTML tags removed.
+func plainify(s any) (string, error) {
+	nodes, err := html.ParseFragment(strings.NewReader(toString(s)), &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body})
+	if err != nil {
+		return "", fmt.Errorf("cannot plainify %q: %w", s, err)
+	}
+	var b strings.Builder
+	for _, n := range nodes {
+		b.WriteString(text(n))
+	}
+	return b.String(), nil
+}
+
+// absURL returns p as an absolute URL on the website,
+// using development.url while serving and production.url otherwise.
+// If p is already absolute,
+// it is returned as is.
+func absURL(cfg *Config, p string) (string, error) {
+	ref, err := url.Parse(p)
+	if err != nil {
+		return "", fmt.Errorf("cannot parse URL %q: %w", p, err)
+	}
+	if ref.IsAbs() || cfg == nil {
+		return p, nil
+	}
+	site := cfg.Production.URL
+	if cfg.Serving {
+		site = cfg.Development.URL
+	}
+	// production.url is usually a bare host,
+	// as in twos.dev.
+	if !strings.Contains(site, "://") {
+		site = "https://" + site
+	}
+	base, err := url.Parse(site)
+	if err != nil {
+		return "", fmt.Errorf("cannot parse site URL %q: %w", site, err)
+	}
+	u := *base
+	u.Path = path.Join("/", base.Path, ref.Path)
+	if strings.HasSuffix(ref.Path, "/") && u.Path != "/" {
+		u.Path += "/"
+	}
+	u.RawQuery = ref.RawQuery
+	u.Fragment = ref.Fragment
+	return u.String(), nil
+}
+
+// first returns the first n items of list,
+// or all of them if it has fewer.
+func first(n int, list any) (any, error) {
+	v, err := sliceOf(list)
+	if err != nil {
+		return nil, fmt.Errorf("cannot take first %d: %w", n, err)
+	}
+	return v.Slice(0, max(0, min(n, v.Len()))).Interface(), nil
+}
+
+// last returns the last n items of list,
+// or all of them if it has fewer.
+func last(n int, list any) (any, error) {
+	v, err := sliceOf(list)
+	if err != nil {
+		return nil, fmt.Errorf("cannot take last %d: %w", n, err)
+	}
+	return v.Slice(v.Len()-max(0, min(n, v.Len())), v.Len()).Interface(), nil
+}
+
+// reverse returns the items of list in reverse order.
+func reverse(list any) (any, error) {
+	v, err := sliceOf(list)
+	if err != nil {
+		return nil, fmt.Errorf("cannot reverse: %w", err)
+	}
+	r := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+	for i := range v.Len() {
+		r.Index(v.Len() - 1 - i).Set(v.Index(i))
+	}
+	return r.Interface(), nil
+}
+
+// group is a set of items that share a key,
+// as returned by [groupBy].
+type group struct {
+	// Key is the value the items share.
+	Key any
+	// Items are the items with the key,
+	// in the order they were given.
+	Items any
+}
+
+// groupBy groups the items of list by the value of key in each,
+// in the order each key first appears.
+// See [keyOf] for what key may be.
+func groupBy(key string, list any) ([]group, error) {
+	v, err := sliceOf(list)
+	if err != nil {
+		return nil, fmt.Errorf("cannot group by %q: %w", key, err)
+	}
+	var groups []group
+	items := []reflect.Value{}
+	index := map[any]int{}
+	for i := range v.Len() {
+		k, err := keyOf(v.Index(i), key)
+		if err != nil {
+			return nil, fmt.Errorf("cannot group by %q: %w", key, err)
+		}
+		id := k.Interface()
+		if !k.Comparable() {
+			id = fmt.Sprint(id)
+		}
+		j, ok := index[id]
+		if !ok {
+			j = len(groups)
+			index[id] = j
+			groups = append(groups, group{Key: k.Interface()})
+			items = append(items, reflect.MakeSlice(v.Type(), 0, 1))
+		}
+		items[j] = reflect.Append(items[j], v.Index(i))
+	}
+	for i := range groups {
+		groups[i].Items = items[i].Interface()
+	}
+	return groups, nil
+}
+
+// sortBy returns the items of list sorted by the value of key in each,
+// from least to greatest.
+// Items with equal values keep their order.
+// See [keyOf] for what key may be.
+//
+// Strings, numbers, booleans, and times are compared by value;
+// anything else is compared by how it prints.
+func sortBy(key string, list any) (any, error) {
+	v, err := sliceOf(list)
+	if err != nil {
+		return nil, fmt.Errorf("cannot sort by %q: %w", key, err)
+	}
+	keys := make([]reflect.Value, v.Len())
+	order := make([]int, v.Len())
+	for i := range v.Len() {
+		if keys[i], err = keyOf(v.Index(i), key); err != nil {
+			return nil, fmt.Errorf("cannot sort by %q: %w", key, err)
+		}
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return less(keys[order[i]], keys[order[j]])
+	})
+	sorted := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+	for i, j := range order {
+		sorted.Index(i).Set(v.Index(j))
+	}
+	return sorted.Interface(), nil
+}
+
+// less reports whether a sorts before b.
+func less(a, b reflect.Value) bool {
+	if a.Kind() != b.Kind() {
+		return fmt.Sprint(a.Interface()) < fmt.Sprint(b.Interface())
+	}
+	switch a.Kind() {
+	case reflect.String:
+		return a.String() < b.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() < b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return a.Uint() < b.Uint()
+	case reflect.Float32, reflect.Float64:
+		return a.Float() < b.Float() || math.IsNaN(b.Float()) && !math.IsNaN(a.Float())
+	case reflect.Bool:
+		return !a.Bool() && b.Bool()
+	}
+	ta, aok := a.Interface().(time.Time)
+	tb, bok := b.Interface().(time.Time)
+	if aok && bok {
+		return ta.Before(tb)
+	}
+	return fmt.Sprint(a.Interface()) < fmt.Sprint(b.Interface())
+}
+
+// sliceOf returns list as a slice or array value.
+func sliceOf(list any) (reflect.Value, error) {
+	v := reflect.ValueOf(list)
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Array {
+		s := reflect.MakeSlice(reflect.SliceOf(v.Type().Elem()), v.Len(), v.Len())
+		reflect.Copy(s, v)
+		v = s
+	}
+	if v.Kind() != reflect.Slice {
+		return reflect.Value{}, fmt.Errorf("%T is not a list", list)
+	}
+	return v, nil
+}
+
+// keyOf returns the value at key in item.
+//
+// key is a dot-separated path of fields, methods, or map keys,
+// such as Title or Metadata.CreatedAt.
+// An empty key is item itself.
+// Documents also look up keys in their metadata,
+// so Title finds the title of a document.
+func keyOf(item reflect.Value, key string) (reflect.Value, error) {
+	v := item
+	if key == "" {
+		return indirect(v), nil
+	}
+	for _, name := range strings.Split(key, ".") {
+		next, ok := lookup(v, name)
+		if !ok {
+			// A nil document has no metadata to look in.
+			if doc, isDoc := v.Interface().(Document); isDoc && indirect(v).Kind() != reflect.Pointer {
+				next, ok = lookup(reflect.ValueOf(doc.Metadata()), name)
+			}
+		}
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("%s has no %q", indirect(v).Type(), name)
+		}
+		v = next
+	}
+	return indirect(v), nil
+}
+
+// lookup returns the method result, field, or map value named name in v.
+// Nothing is found in a nil pointer or interface.
+func lookup(v reflect.Value, name string) (reflect.Value, bool) {
+	for {
+		if (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) && v.IsNil() {
+			return reflect.Value{}, false
+		}
+		if m := v.MethodByName(name); m.IsValid() && m.Type().NumIn() == 0 && m.Type().NumOut() == 1 {
+			return m.Call(nil)[0], true
+		}
+		if v.Kind() != reflect.Pointer && v.Kind() != reflect.Interface {
+			break
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		if f, ok := v.Type().FieldByName(name); ok && f.IsExported() {
+			return v.FieldByIndex(f.Index), true
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() == reflect.String {
+			if e := v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key())); e.IsValid() {
+				return e, true
+			}
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// indirect returns the value v points to or holds,
+// following pointers and interfaces.
+func indirect(v reflect.Value) reflect.Value {
+	for (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) && !v.IsNil() {
+		v = v.Elem()
+	}
+	return v
+}
@@ -0,0 +1,174 @@
+package document // import "twos.dev/winter/document"
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestHelpers(t *testing.T) {
+	cfg := &Config{At: time.Date(2025, time.June, 1, 12, 0, 0, 0, time.UTC)}
+	cfg.Production.URL = "twos.dev"
+	cfg.Development.URL = "http://localhost:8100"
+
+	for _, test := range []struct {
+		name    string
+		input   string
+		serving bool
+		want    string
+	}{
+		{
+			name:  "ISODate",
+			input: `{{ isoDate .CreatedAt }}`,
+			want:  "2025-05-18",
+		},
+		{
+			name:  "RFC3339",
+			input: `{{ rfc3339 .CreatedAt }}`,
+			want:  "2025-05-18T09:30:00Z",
+		},
+		{
+			name:  "RelativeDate",
+			input: `{{ relativeDate .CreatedAt }}`,
+			want:  "2 weeks ago",
+		},
+		{
+			name:  "Slugify",
+			input: `{{ .Title | slugify }}`,
+			want:  "building-a-kiln-part-1",
+		},
+		{
+			name:  "Truncate",
+			input: `{{ "The kiln is hot and the cones are melting." | truncate 20 }}`,
+			want:  "The kiln is hot and…",
+		},
+		{
+			name:  "Markdownify",
+			input: `{{ "Cone *10*" | markdownify }}`,
+			want:  "Cone <em>10</em>",
+		},
+		{
+			name:  "Plainify",
+			input: `{{ "<p>Cone <em>10</em></p>" | plainify }}`,
+			want:  "Cone 10",
+		},
+		{
+			name:  "AbsURL",
+			input: `{{ absURL "/kiln.html#firing" }}`,
+			want:  "https://twos.dev/kiln.html#firing",
+		},
+		{
+			name:    "AbsURLServing",
+			input:   `{{ absURL "kiln.html" }}`,
+			serving: true,
+			want:    "http://localhost:8100/kiln.html",
+		},
+		{
+			name:  "SafeHTML",
+			input: `{{ "<b>hot</b>" | safeHTML }}`,
+			want:  "<b>hot</b>",
+		},
+		{
+			name:  "SafeCSS",
+			input: `<p style="{{ "color: red" | safeCSS }}">`,
+			want:  `<p style="color: red">`,
+		},
+		{
+			name:  "SafeJS",
+			input: `<script>{{ "const hot = true" | safeJS }}</script>`,
+			want:  `<script>const hot = true</script>`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			cfg.Serving = test.serving
+			src := "src/test/" + test.name
+			meta := NewMetadata(src, filepath.Join("testdata", "templates"))
+			doc := NewTemplateDocument(src, meta, newTemplates(cfg, nil, nil, nil), nil)
+			assert.NilError(t, doc.Load(strings.NewReader(test.input)))
+			meta.Layout = ""
+			meta.Title = "Building a Kiln, Part 1"
+			meta.CreatedAt = time.Date(2025, time.May, 18, 9, 30, 0, 0, time.UTC)
+			var got bytes.Buffer
+			assert.NilError(t, doc.Render(&got))
+			assert.Equal(t, strings.TrimSuffix(got.String(), "\n"), test.want)
+		})
+	}
+}
+
+func TestRelativeDate(t *testing.T) {
+	now := time.Date(2025, time.June, 1, 12, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		t    time.Time
+		want string
+	}{
+		{time.Time{}, ""},
+		{now.Add(-30 * time.Second), "just now"},
+		{now.Add(-time.Minute), "1 minute ago"},
+		{now.Add(-5 * time.Hour), "5 hours ago"},
+		{now.AddDate(0, 0, -3), "3 days ago"},
+		{now.AddDate(0, -2, 0), "2 months ago"},
+		{now.AddDate(-3, 0, 0), "3 years ago"},
+		{now.AddDate(0, 0, 1), "in 1 day"},
+	} {
+		assert.Equal(t, relativeDate(test.t, now), test.want)
+	}
+}
+
+func TestCollectionHelpers(t *testing.T) {
+	docs := []Document{
+		testDocument("Glazes", post, time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC)),
+		testDocument("Kilns", draft, time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)),
+		testDocument("Clay", post, time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)),
+	}
+	titles := func(list any) []string {
+		var titles []string
+		for _, doc := range list.([]Document) {
+			titles = append(titles, doc.Metadata().Title)
+		}
+		return titles
+	}
+
+	got, err := first(2, docs)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, titles(got), []string{"Glazes", "Kilns"})
+
+	got, err = last(5, docs)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, titles(got), []string{"Glazes", "Kilns", "Clay"})
+
+	got, err = sortBy("Title", docs)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, titles(got), []string{"Clay", "Glazes", "Kilns"})
+
+	got, err = sortBy("Metadata.CreatedAt", docs)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, titles(got), []string{"Clay", "Kilns", "Glazes"})
+
+	got, err = reverse(docs)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, titles(got), []string{"Clay", "Kilns", "Glazes"})
+
+	groups, err := groupBy("Kind", docs)
+	assert.NilError(t, err)
+	assert.Equal(t, len(groups), 2)
+	assert.Equal(t, groups[0].Key, post)
+	assert.DeepEqual(t, titles(groups[0].Items), []string{"Glazes", "Clay"})
+	assert.Equal(t, groups[1].Key, draft)
+	assert.DeepEqual(t, titles(groups[1].Items), []string{"Kilns"})
+
+	_, err = sortBy("Glaze", docs)
+	assert.ErrorContains(t, err, `has no "Glaze"`)
+	_, err = sortBy("Title", []*HTMLDocument{nil})
+	assert.ErrorContains(t, err, `has no "Title"`)
+
+	mixed := []any{struct{ Name string }{"kiln"}, time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)}
+	got, err = sortBy("", mixed)
+	assert.NilError(t, err)
+	assert.Equal(t, got.([]any)[0], mixed[1])
+	_, err = first(1, "clay")
+	assert.ErrorContains(t, err, "string is not a list")
+}
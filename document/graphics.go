@@ -0,0 +1,216 @@
+package document // import "twos.dev/winter/document"
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"twos.dev/winter/graphic"
+)
+
+// Graphic is an image or video found by [Graphics.Find].
+type Graphic struct {
+	// Image is the gallery image the graphic is,
+	// with its thumbnails and EXIF data,
+	// or nil if it is not a gallery image.
+	Image *img
+	// SourcePath is the path to the graphic's file,
+	// relative to the working directory.
+	SourcePath string
+	// Video is a flag that marks the graphic as a video rather than an image.
+	Video bool
+	// WebPath is the path component of the URL the graphic is served at.
+	WebPath string
+}
+
+// Graphics finds the images and videos of a site by shortname,
+// such as cat for src/img/2023/cat.jpg.
+// It looks in src/img,
+// then public,
+// then the img directory of each additional source directory.
+//
+// Graphics found in source directories are built just in time if they haven't been built yet,
+// so pages can reference them before or without a full build.
+//
+// Each directory is walked once,
+// the first time a graphic is looked for in it;
+// see [Graphics.forget].
+type Graphics struct {
+	s *Substructure
+
+	mu sync.Mutex
+	// indexes holds the files in each directory searched so far,
+	// by directory.
+	indexes map[string]*graphic.Index
+}
+
+// graphicDir is a directory graphics are found in.
+type graphicDir struct {
+	path string
+	// static is a flag that marks the directory as copied into dist as is,
+	// so graphics in it are served from their path within it
+	// rather than built into img.
+	static bool
+}
+
+// Find returns the graphic with the given shortname.
+// For the shortname rules, see [graphic.Index.Discover].
+func (g *Graphics) Find(shortname string) (*Graphic, error) {
+	if g == nil || g.s == nil {
+		return nil, fmt.Errorf("cannot find graphic %q without a substructure", shortname)
+	}
+	exts := map[string]struct{}{}
+	for ext := range graphic.ImageExts {
+		exts[ext] = struct{}{}
+	}
+	for ext := range graphic.VideoExts {
+		exts[ext] = struct{}{}
+	}
+	var searched []string
+	for _, dir := range g.dirs() {
+		searched = append(searched, dir.path)
+		idx, err := g.index(dir.path)
+		if err != nil {
+			return nil, err
+		}
+		src, err := idx.Discover(graphic.SRC(shortname), exts)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		rel, err := filepath.Rel(dir.path, src)
+		if err != nil {
+			return nil, fmt.Errorf("cannot find web path of graphic %q: %w", src, err)
+		}
+		ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(src), "."))
+		_, video := graphic.VideoExts[ext]
+		found := &Graphic{SourcePath: src, Video: video}
+		if dir.static {
+			found.WebPath = "/" + filepath.ToSlash(rel)
+			return found, nil
+		}
+		found.WebPath = "/" + filepath.ToSlash(filepath.Join("img", rel))
+		if im, ok := g.s.imgBySourcePath(src); ok {
+			if err := g.s.ensureIMG(im); err != nil {
+				return nil, err
+			}
+			found.Image = im
+			found.WebPath = "/" + filepath.ToSlash(im.WebPath)
+			return found, nil
+		}
+		if err := copyIfNewer(src, filepath.Join(g.s.cfg.Dist, filepath.FromSlash(found.WebPath))); err != nil {
+			return nil, err
+		}
+		return found, nil
+	}
+	return nil, fmt.Errorf("no graphic %q in %s: %w", shortname, strings.Join(searched, ", "), os.ErrNotExist)
+}
+
+// dirs returns the directories graphics are found in, in order of precedence.
+func (g *Graphics) dirs() []graphicDir {
+	dirs := []graphicDir{
+		{path: filepath.Join("src", "img")},
+		{path: "public", static: true},
+	}
+	for _, src := range g.s.cfg.Src {
+		dirs = append(dirs, graphicDir{path: filepath.Join(src, "img")})
+	}
+	return dirs
+}
+
+// index returns the files in dir,
+// walking it only if it hasn't been walked since it was last forgotten.
+func (g *Graphics) index(dir string) (*graphic.Index, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if idx, ok := g.indexes[dir]; ok {
+		return idx, nil
+	}
+	idx, err := graphic.NewIndex(dir)
+	if err != nil {
+		return nil, err
+	}
+	if g.indexes == nil {
+		g.indexes = map[string]*graphic.Index{}
+	}
+	g.indexes[dir] = idx
+	return idx, nil
+}
+
+// forget drops the files listed for any directory containing path,
+// so the directory is walked again the next time a graphic is looked for in it.
+// If path is empty,
+// every directory is forgotten.
+func (g *Graphics) forget(path string) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for dir := range g.indexes {
+		rel, err := filepath.Rel(dir, path)
+		if path == "" || (err == nil && !strings.HasPrefix(rel, "..")) {
+			delete(g.indexes, dir)
+		}
+	}
+}
+
+// imgBySourcePath returns the gallery image built from the file at src.
+//
+// If no such image exists, ok is false.
+func (s *Substructure) imgBySourcePath(src string) (im *img, ok bool) {
+	for _, gallery := range s.galleries {
+		for _, im := range gallery {
+			if filepath.Clean(im.SourcePath) == filepath.Clean(src) {
+				return im, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// ensureIMG builds im into dist if it hasn't been built there yet,
+// such as when a page references an image added since the last full build.
+func (s *Substructure) ensureIMG(im *img) error {
+	if _, err := os.Stat(filepath.Join(s.cfg.Dist, im.WebPath)); err == nil {
+		return nil
+	}
+	if _, err := s.buildIMG(im, s.cfg.Dist); err != nil {
+		return fmt.Errorf("cannot build image %q just in time: %w", im.SourcePath, err)
+	}
+	return nil
+}
+
+// copyIfNewer copies the file at src to dest,
+// unless dest is already at least as new as src.
+func copyIfNewer(src, dest string) error {
+	srcStat, err := os.Stat(src)
+	if err != nil {
+		return fmt.Errorf("cannot stat graphic %q: %w", src, err)
+	}
+	if destStat, err := os.Stat(dest); err == nil && !destStat.ModTime().Before(srcStat.ModTime()) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return fmt.Errorf("cannot make directory for graphic %q: %w", dest, err)
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("cannot read graphic %q: %w", src, err)
+	}
+	defer in.Close()
+	out, err := os.Create(dest)
+	if err != nil {
+		return fmt.Errorf("cannot write graphic %q: %w", dest, err)
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, in); err != nil {
+		return fmt.Errorf("cannot copy graphic %q to %q: %w", src, dest, err)
+	}
+	return nil
+}
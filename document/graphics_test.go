@@ -0,0 +1,130 @@
+package document // import "twos.dev/winter/document"
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	"twos.dev/winter/graphic"
+)
+
+func TestGraphicsFind(t *testing.T) {
+	tmp := t.TempDir()
+	cwd, err := os.Getwd()
+	assert.NilError(t, err)
+	assert.NilError(t, os.Chdir(tmp))
+	t.Cleanup(func() {
+		_ = os.Chdir(cwd)
+	})
+
+	for _, f := range []string{
+		filepath.Join("src", "img", "2023", "dog.gif"),
+		filepath.Join("src", "img", "2023", "clip.webm"),
+		filepath.Join("src", "img", "2022", "bird.png"),
+		filepath.Join("src", "img", "2023", "bird.png"),
+		filepath.Join("public", "img", "chart.svg"),
+		filepath.Join("public", "img", "dog.gif"),
+		filepath.Join("notes", "img", "fern.avif"),
+		filepath.Join("notes", "img", "notes.txt"),
+	} {
+		assert.NilError(t, os.MkdirAll(filepath.Dir(f), 0o755))
+		assert.NilError(t, os.WriteFile(f, []byte(f), 0o644))
+	}
+	gallery := filepath.Join("src", "img", "2023", "trip", "IMG_0385.JPG")
+	assert.NilError(t, os.MkdirAll(filepath.Dir(gallery), 0o755))
+	assert.NilError(t, copyFile(filepath.Join(cwd, "testdata", "IMG_0385.JPG"), gallery))
+
+	s := &Substructure{cfg: &Config{Dist: "dist", Src: []string{"notes"}}}
+	s.graphics = &Graphics{s: s}
+	assert.NilError(t, s.discoverGalleries("src"))
+	// Pretend the gallery image is built so it isn't encoded just in time.
+	built := filepath.Join("dist", "img", "2023", "trip", "IMG_0385.webp")
+	assert.NilError(t, os.MkdirAll(filepath.Dir(built), 0o755))
+	assert.NilError(t, os.WriteFile(built, nil, 0o644))
+
+	for _, test := range []struct {
+		name      string
+		shortname string
+		webPath   string
+		video     bool
+		gallery   bool
+		copied    string
+		err       error
+	}{
+		{
+			name:      "Source",
+			shortname: "dog",
+			webPath:   "/img/2023/dog.gif",
+			copied:    filepath.Join("dist", "img", "2023", "dog.gif"),
+		},
+		{
+			name:      "Video",
+			shortname: "2023/clip",
+			webPath:   "/img/2023/clip.webm",
+			video:     true,
+			copied:    filepath.Join("dist", "img", "2023", "clip.webm"),
+		},
+		{
+			name:      "Gallery",
+			shortname: "IMG_0385",
+			webPath:   "/img/2023/trip/IMG_0385.webp",
+			gallery:   true,
+		},
+		{
+			name:      "Public",
+			shortname: "chart",
+			webPath:   "/img/chart.svg",
+		},
+		{
+			name:      "ExtraSource",
+			shortname: "fern",
+			webPath:   "/img/fern.avif",
+			copied:    filepath.Join("dist", "img", "fern.avif"),
+		},
+		{
+			name:      "Disambiguated",
+			shortname: "2022/bird",
+			webPath:   "/img/2022/bird.png",
+			copied:    filepath.Join("dist", "img", "2022", "bird.png"),
+		},
+		{
+			name:      "Ambiguous",
+			shortname: "bird",
+			err:       graphic.ErrAmbiguous,
+		},
+		{
+			name:      "Missing",
+			shortname: "notes",
+			err:       os.ErrNotExist,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			g, err := s.graphics.Find(test.shortname)
+			if test.err != nil {
+				assert.Assert(t, errors.Is(err, test.err), "got %v", err)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Equal(t, g.WebPath, test.webPath)
+			assert.Equal(t, g.Video, test.video)
+			assert.Equal(t, g.Image != nil, test.gallery)
+			if test.copied != "" {
+				_, err := os.Stat(test.copied)
+				assert.NilError(t, err)
+			}
+		})
+	}
+
+	t.Run("Added", func(t *testing.T) {
+		added := filepath.Join("public", "img", "owl.svg")
+		assert.NilError(t, os.WriteFile(added, nil, 0o644))
+		_, err := s.graphics.Find("owl")
+		assert.Assert(t, errors.Is(err, os.ErrNotExist), "got %v", err)
+		s.graphics.forget(added)
+		g, err := s.graphics.Find("owl")
+		assert.NilError(t, err)
+		assert.Equal(t, g.WebPath, "/img/owl.svg")
+	})
+}
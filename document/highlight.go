@@ -0,0 +1,282 @@
+package document // import "twos.dev/winter/document"
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/chroma"
+	chromahtml "github.com/alecthomas/chroma/formatters/html"
+	"github.com/alecthomas/chroma/lexers"
+	"github.com/alecthomas/chroma/styles"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const (
+	// highlightAttr is the attribute of a <code> element that holds its highlighting options,
+	// such as data-highlight="linenos=false hl_lines=[3,5-7] start=10".
+	highlightAttr = "data-highlight"
+	// literalAttr is the attribute of a <code> element whose text is shown as written,
+	// even where it looks like Go template syntax,
+	// such as code from a Jupyter notebook.
+	literalAttr = "data-literal"
+
+	defaultHighlightStyle = "dracula"
+	defaultTabWidth       = 2
+
+	lineNumbersInline = "inline"
+	lineNumbersTable  = "table"
+	lineNumbersNone   = "none"
+)
+
+// highlightOption matches a single key=value pair of highlighting options.
+// Values can be bare, quoted, or bracketed lists.
+var highlightOption = regexp.MustCompile(`(\w+)=("[^"]*"|\[[^\]]*\]|\S+)`)
+
+// highlightOptions are the options for syntax highlighting a single code block.
+type highlightOptions struct {
+	// lineNumbers is one of lineNumbersInline, lineNumbersTable, or lineNumbersNone.
+	lineNumbers string
+	// lines are the ranges of lines to emphasize,
+	// counted from 1 at the first line of the block.
+	lines [][2]int
+	// start is the number of the first line of the block.
+	start int
+	// tabWidth is the number of spaces a tab is displayed as.
+	tabWidth int
+}
+
+// defaultHighlightOptions returns the site-wide highlighting options from cfg,
+// which may be nil.
+func defaultHighlightOptions(cfg *Config) highlightOptions {
+	opts := highlightOptions{
+		lineNumbers: lineNumbersInline,
+		start:       1,
+		tabWidth:    defaultTabWidth,
+	}
+	if cfg == nil {
+		return opts
+	}
+	if cfg.Highlight.LineNumbers != "" {
+		opts.lineNumbers = cfg.Highlight.LineNumbers
+	}
+	if cfg.Highlight.TabWidth > 0 {
+		opts.tabWidth = cfg.Highlight.TabWidth
+	}
+	return opts
+}
+
+// parse overrides opts with the options in s,
+// a space-separated list of key=value pairs such as "linenos=false hl_lines=[3,5-7] start=10".
+func (opts *highlightOptions) parse(s string) error {
+	for _, m := range highlightOption.FindAllStringSubmatch(s, -1) {
+		key, val := m[1], strings.Trim(m[2], `"`)
+		switch key {
+		case "linenos":
+			switch val {
+			case "true":
+				if opts.lineNumbers == lineNumbersNone {
+					opts.lineNumbers = lineNumbersInline
+				}
+			case "false":
+				opts.lineNumbers = lineNumbersNone
+			case lineNumbersInline, lineNumbersTable:
+				opts.lineNumbers = val
+			default:
+				return fmt.Errorf("linenos must be true, false, inline, or table, not %q", val)
+			}
+		case "hl_lines":
+			lines, err := parseLineRanges(val)
+			if err != nil {
+				return err
+			}
+			opts.lines = lines
+		case "start":
+			start, err := strconv.Atoi(val)
+			if err != nil {
+				return fmt.Errorf("start must be a number, not %q", val)
+			}
+			opts.start = start
+		default:
+			return fmt.Errorf("unknown code block option %q", key)
+		}
+	}
+	return nil
+}
+
+// parseLineRanges parses a list of line numbers and ranges such as "[3,5-7]" or "3 5-7".
+func parseLineRanges(s string) ([][2]int, error) {
+	var ranges [][2]int
+	fields := strings.FieldsFunc(strings.Trim(s, "[]"), func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+	for _, field := range fields {
+		from, to, isRange := strings.Cut(field, "-")
+		first, err := strconv.Atoi(from)
+		if err != nil {
+			return nil, fmt.Errorf("hl_lines must list line numbers or ranges, not %q", field)
+		}
+		last := first
+		if isRange {
+			if last, err = strconv.Atoi(to); err != nil || last < first {
+				return nil, fmt.Errorf("hl_lines must list line numbers or ranges, not %q", field)
+			}
+		}
+		ranges = append(ranges, [2]int{first, last})
+	}
+	return ranges, nil
+}
+
+// newHighlightFormatter returns a Chroma HTML formatter that emits classes instead of inline styles,
+// configured with opts.
+func newHighlightFormatter(opts highlightOptions) *chromahtml.Formatter {
+	// Chroma numbers highlighted lines from the first line number,
+	// but they are written counting from the first line of the block.
+	lines := make([][2]int, len(opts.lines))
+	for i, r := range opts.lines {
+		lines[i] = [2]int{r[0] + opts.start - 1, r[1] + opts.start - 1}
+	}
+	return chromahtml.New(
+		chromahtml.Standalone(false),
+		chromahtml.TabWidth(opts.tabWidth),
+		chromahtml.WithClasses(true),
+		chromahtml.WithLineNumbers(opts.lineNumbers != lineNumbersNone),
+		chromahtml.LineNumbersInTable(opts.lineNumbers == lineNumbersTable),
+		chromahtml.BaseLineNumber(opts.start),
+		chromahtml.HighlightLines(lines),
+	)
+}
+
+// WriteHighlightCSS writes the CSS for the classes Winter gives highlighted code,
+// colored according to the Chroma style with the given name.
+// If name is blank, the style configured in cfg is used,
+// or a default style if none is.
+// cfg may be nil.
+//
+// For a list of styles, see https://xyproto.github.io/splash/docs/.
+func WriteHighlightCSS(w io.Writer, cfg *Config, name string) error {
+	if name == "" && cfg != nil {
+		name = cfg.Highlight.Style
+	}
+	if name == "" {
+		name = defaultHighlightStyle
+	}
+	style, ok := styles.Registry[name]
+	if !ok {
+		return fmt.Errorf("no highlighting style named %q", name)
+	}
+	return newHighlightFormatter(defaultHighlightOptions(cfg)).WriteCSS(w, style)
+}
+
+func (doc *HTMLDocument) highlightCode() error {
+	var cfg *Config
+	if doc.s != nil {
+		cfg = doc.s.cfg
+	}
+	for codeBlock := range codeBlocks(doc.root) {
+		opts := defaultHighlightOptions(cfg)
+		if err := opts.parse(highlightSpec(codeBlock)); err != nil {
+			return fmt.Errorf("cannot highlight code block in %s: %w", doc.meta.SourcePath, err)
+		}
+		lang := lang(codeBlock)
+		formatted, err := syntaxHighlight(lang, codeBlock.FirstChild.Data, opts)
+		if err != nil {
+			return err
+		}
+		literal := isLiteralCode(codeBlock)
+
+		ancestry := doc.root
+		if ancestry.Type == html.DocumentNode {
+			ancestry = ancestry.FirstChild
+		}
+		pre, err := html.ParseFragment(strings.NewReader(formatted), ancestry)
+		if err != nil {
+			return fmt.Errorf("can't parse HTML %q: %w", formatted, err)
+		}
+		if literal {
+			// Highlighting splits any template delimiters from what is between them,
+			// so they can only be made literal once it is done.
+			for _, fragment := range pre {
+				for _, text := range allOfNodeTypes(fragment, map[html.NodeType]struct{}{html.TextNode: {}}) {
+					text.Data = literalTemplates.Replace(text.Data)
+				}
+			}
+		}
+		originalPre := codeBlock.Parent
+		for _, fragment := range pre {
+			if fragment.DataAtom == atom.Head {
+				continue
+			}
+			if fragment.DataAtom == atom.Body {
+				f := fragment.FirstChild
+				f.Parent = nil
+				originalPre.Parent.InsertBefore(f, originalPre)
+			}
+		}
+		originalPre.Parent.RemoveChild(originalPre)
+	}
+
+	return nil
+}
+
+// highlightSpec returns the highlighting options written on a <code> element.
+func highlightSpec(code *html.Node) string {
+	for _, a := range code.Attr {
+		if a.Key == highlightAttr {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// isLiteralCode reports whether a <code> element is to be shown as written;
+// see literalAttr.
+func isLiteralCode(code *html.Node) bool {
+	for _, a := range code.Attr {
+		if a.Key == literalAttr {
+			return true
+		}
+	}
+	return false
+}
+
+func lang(code *html.Node) string {
+	for _, class := range strings.Fields(attr(code, atom.Class)) {
+		if _, l, ok := strings.Cut(class, "language-"); ok {
+			return l
+		}
+	}
+
+	return ""
+}
+
+func syntaxHighlight(lang, code string, opts highlightOptions) (string, error) {
+	// Determine lexer.
+	lexer := lexers.Get(lang)
+	if lexer == nil {
+		lexer = lexers.Analyse(code)
+	}
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	lexer = chroma.Coalesce(lexer)
+	formatter := newHighlightFormatter(opts)
+
+	// The style has no effect on the output because classes are emitted instead of inline styles.
+	// Colors come from CSS, such as that written by WriteHighlightCSS.
+	s := styles.Get(defaultHighlightStyle)
+	it, err := lexer.Tokenise(nil, code)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := formatter.Format(&buf, s, it); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,84 @@
+package document // import "twos.dev/winter/document"
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestHighlightOptionsParse(t *testing.T) {
+	for _, test := range []struct {
+		spec string
+		cfg  *Config
+		want highlightOptions
+		err  string
+	}{
+		{
+			spec: "",
+			want: highlightOptions{lineNumbers: lineNumbersInline, start: 1, tabWidth: 2},
+		},
+		{
+			spec: "linenos=false hl_lines=[3,5-7] start=10",
+			want: highlightOptions{lineNumbers: lineNumbersNone, lines: [][2]int{{3, 3}, {5, 7}}, start: 10, tabWidth: 2},
+		},
+		{
+			spec: `linenos=table hl_lines="1 2"`,
+			want: highlightOptions{lineNumbers: lineNumbersTable, lines: [][2]int{{1, 1}, {2, 2}}, start: 1, tabWidth: 2},
+		},
+		{
+			spec: "linenos=true",
+			cfg:  &Config{},
+			want: highlightOptions{lineNumbers: lineNumbersTable, start: 1, tabWidth: 4},
+		},
+		{spec: "linenos=sometimes", err: "linenos must be"},
+		{spec: "hl_lines=[7-5]", err: "hl_lines must"},
+		{spec: "start=ten", err: "start must"},
+		{spec: "colour=red", err: "unknown code block option"},
+	} {
+		t.Run(test.spec, func(t *testing.T) {
+			if test.cfg != nil {
+				test.cfg.Highlight.LineNumbers = lineNumbersTable
+				test.cfg.Highlight.TabWidth = 4
+			}
+			opts := defaultHighlightOptions(test.cfg)
+			err := opts.parse(test.spec)
+			if test.err != "" {
+				assert.ErrorContains(t, err, test.err)
+				return
+			}
+			assert.NilError(t, err)
+			assert.Assert(t, reflect.DeepEqual(opts, test.want), "got %+v, want %+v", opts, test.want)
+		})
+	}
+}
+
+func TestHTMLHighlightCode(t *testing.T) {
+	src := "src/test/HighlightCode"
+	doc := NewHTMLDocument(
+		src,
+		NewMetadata(src, filepath.Join("testdata", "templates")),
+		nil,
+		nil,
+	)
+	input := `<pre><code class="language-go" data-highlight="hl_lines=[2] start=10">package main
+
+func main() {}
+</code></pre>`
+	assert.NilError(t, doc.Load(strings.NewReader(input)))
+	var actual bytes.Buffer
+	assert.NilError(t, doc.Render(&actual))
+	assert.Assert(t, strings.Contains(actual.String(), `<span class="ln">10</span>`), actual.String())
+	assert.Assert(t, strings.Contains(actual.String(), `<span class="line hl"><span class="ln">11</span>`), actual.String())
+	assert.Assert(t, !strings.Contains(actual.String(), `data-highlight`), actual.String())
+}
+
+func TestWriteHighlightCSS(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NilError(t, WriteHighlightCSS(&buf, nil, "monokai"))
+	assert.Assert(t, strings.Contains(buf.String(), ".chroma .hl"), buf.String())
+	assert.ErrorContains(t, WriteHighlightCSS(&buf, nil, "nonexistent"), "no highlighting style")
+}
@@ -3,18 +3,12 @@ package document // import "twos.dev/winter/document"
 import (
 	"bytes"
 	"fmt"
-	"html/template"
 	"io"
 	"net/url"
-	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
 
-	"github.com/alecthomas/chroma"
-	chromahtml "github.com/alecthomas/chroma/formatters/html"
-	"github.com/alecthomas/chroma/lexers"
-	"github.com/alecthomas/chroma/styles"
 	"golang.org/x/net/html"
 	"golang.org/x/net/html/atom"
 )
@@ -129,17 +123,30 @@ type HTMLDocument struct {
 	meta   *Metadata
 	next   Document
 	result []byte
+	// feedResult is the rendered document as it appears in feeds,
+	// or nil if it appears the same as on its page.
+	feedResult []byte
 	// root is the topmost HTML tag in the parsed document,
 	// usually <html> or its parent.
 	root *html.Node
+	// feedRoot is root as it was before massaging that feeds leave out,
+	// such as moving footnotes into sidenotes,
+	// or nil if there was none.
+	feedRoot *html.Node
+	// s is the substructure the document belongs to,
+	// used to look up other documents and site-wide configuration.
+	// It may be nil,
+	// in which case steps that need it are skipped.
+	s *Substructure
 }
 
-// NewHTMLDocument creates a new document whose original source is at path src.
+// NewHTMLDocument creates a new document whose original source is at path src,
+// belonging to the substructure s.
 //
 // Nothing is read from disk; src is metadata.
 // It may or may not point to a file containing HTML.
 // To read and parse HTML, call [Load].
-func NewHTMLDocument(src string, meta *Metadata, next Document) *HTMLDocument {
+func NewHTMLDocument(src string, meta *Metadata, s *Substructure, next Document) *HTMLDocument {
 	return &HTMLDocument{
 		deps: map[string]struct{}{
 			src:                {},
@@ -147,9 +154,19 @@ func NewHTMLDocument(src string, meta *Metadata, next Document) *HTMLDocument {
 		},
 		meta: meta,
 		next: next,
+		s:    s,
 	}
 }
 
+// templates returns the template environment doc renders partials in,
+// which is its substructure's if it has one.
+func (doc *HTMLDocument) templates() *templates {
+	if doc.s != nil && doc.s.templates != nil {
+		return doc.s.templates
+	}
+	return newTemplates(nil, nil, nil, nil)
+}
+
 func (doc *HTMLDocument) DependsOn(src string) bool {
 	if _, ok := doc.deps[src]; ok {
 		return true
@@ -182,25 +199,22 @@ func (doc *HTMLDocument) Load(r io.Reader) error {
 		return err
 	}
 	doc.root = root
+	doc.feedRoot = nil
 	if err := applyEarlyReplacements(doc.root); err != nil {
 		return err
 	}
 	if err := doc.Massage(); err != nil {
 		return err
 	}
-	var buf bytes.Buffer
-	if err := html.Render(&buf, doc.root); err != nil {
-		return fmt.Errorf("cannot render HTML to build %q: %w", doc.meta.WebPath, err)
+	if doc.result, err = doc.renderRoot(doc.root); err != nil {
+		return err
 	}
-	byts := buf.Bytes()
-	for old, new := range lateReplacements {
-		re, err := regexp.Compile(old)
-		if err != nil {
+	doc.feedResult = nil
+	if doc.feedRoot != nil {
+		if doc.feedResult, err = doc.renderRoot(doc.feedRoot); err != nil {
 			return err
 		}
-		byts = re.ReplaceAll(byts, new)
 	}
-	doc.result = byts
 	if doc.next == nil {
 		return nil
 	}
@@ -210,26 +224,73 @@ func (doc *HTMLDocument) Load(r io.Reader) error {
 	return nil
 }
 
+// renderRoot renders the HTML tree under root,
+// then applies the late replacements.
+func (doc *HTMLDocument) renderRoot(root *html.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := html.Render(&buf, root); err != nil {
+		return nil, fmt.Errorf("cannot render HTML to build %q: %w", doc.meta.WebPath, err)
+	}
+	byts := buf.Bytes()
+	for old, new := range lateReplacements {
+		re, err := regexp.Compile(old)
+		if err != nil {
+			return nil, err
+		}
+		byts = re.ReplaceAll(byts, new)
+	}
+	return byts, nil
+}
+
 // Massage messes with loaded content to improve the page when it is ultimately rendered.
 //
 // Massage performs these tasks:
 //
 //   - Linkifies and stylizes the first <h1> as a page title
+//   - Gives every heading a stable ID, and optionally a link to itself
 //   - Generates a table of contents, if requested by metadata
 //   - Sets target=_blank for all <a> tags pointing to external sites
-//   - Generates a preview for the document, if one wasn't manually specified
+//   - Generates a summary for the document, and a preview if one wasn't manually specified
+//   - Rewrites links to source files into links to the documents built from them
+//   - Records the internal documents it links to, for backlinks
+//   - Counts its words, code blocks, images, and headings, and estimates its reading time
+//   - Wraps paragraphs of images, and any captions below them, in figures
+//   - Turns blockquotes that open with a label such as **Note:** into callouts
+//   - Points images at their WebP outputs and thumbnails
+//   - Renders math into MathML, if configured to
+//   - Renders diagrams and other code blocks with a registered renderer
 //   - Syntax-highlights code blocks
+//   - Moves footnotes into sidenotes, if configured to, keeping the original for feeds
 func (doc *HTMLDocument) Massage() error {
 	if err := doc.setTitle(); err != nil {
 		return err
 	}
-	if err := doc.setPreview(); err != nil {
+	doc.setWebPath()
+	doc.setHeadingIDs()
+	if err := doc.resolveSourceLinks(); err != nil {
 		return err
 	}
-	doc.setWebPath()
+	doc.collectLinks()
+	doc.insertFigures()
+	if err := doc.insertCallouts(); err != nil {
+		return err
+	}
+	if err := doc.setResponsiveImages(); err != nil {
+		return err
+	}
+	if err := doc.renderMath(); err != nil {
+		return err
+	}
+	doc.setStats()
 	if err := doc.insertTOC(); err != nil {
 		return err
 	}
+	if err := doc.insertHeadingLinks(); err != nil {
+		return err
+	}
+	if err := doc.renderDiagrams(); err != nil {
+		return err
+	}
 	if err := doc.highlightCode(); err != nil {
 		return err
 	}
@@ -239,6 +300,12 @@ func (doc *HTMLDocument) Massage() error {
 	if err := doc.replaceSpecialText(); err != nil {
 		return err
 	}
+	if err := doc.setPreview(); err != nil {
+		return err
+	}
+	if err := doc.insertSidenotes(); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -251,110 +318,52 @@ func (doc *HTMLDocument) Post() bool {
 }
 
 // Render encodes any loaded content into HTML and writes it to w.
+//
+// While the document is being rendered for a feed,
+// it is rendered as it appears in feeds.
 func (doc *HTMLDocument) Render(w io.Writer) error {
+	result := doc.result
+	if doc.meta.feed && doc.feedResult != nil {
+		result = doc.feedResult
+	}
 	if doc.next == nil {
-		if _, err := io.Copy(w, bytes.NewReader(doc.result)); err != nil {
+		if _, err := io.Copy(w, bytes.NewReader(result)); err != nil {
 			return fmt.Errorf("cannot render HTML: %w", err)
 		}
 		return nil
 	}
+	if doc.meta.feed && doc.feedResult != nil {
+		if err := doc.renderFeed(w); err != nil {
+			return fmt.Errorf("cannot render feed version from %T to %T: %w", doc, doc.next, err)
+		}
+		return nil
+	}
 	if err := doc.next.Render(w); err != nil {
 		return fmt.Errorf("cannot render from %T to %T: %w", doc, doc.next, err)
 	}
 	return nil
 }
 
-// insertTOC creates and inserts a table of contents into the document,
-// if one was requested via metadata.
+// renderFeed renders the feed version of the document through the rest of the chain.
 //
-// Specifically, it iterates over the document looking for non-first-level headings (<h2>, <h3>, etc.)
-// and inserts an ordered hierarchical list of them immediately before the first <h2>.
-func (doc *HTMLDocument) insertTOC() error {
-	if !doc.Metadata().TOC {
-		return nil
-	}
-	var (
-		f func(*html.Node) error
-		v tocPartialVars
-	)
-	f = func(n *html.Node) error {
-		if hi[n.DataAtom] >= tocMin && hi[n.DataAtom] <= tocMax {
-			grp := &v.Items
-			for i := tocMin; i < hi[n.DataAtom] && i < tocMax; i += 1 {
-				if len(*grp) > 0 {
-					grp = &((*grp)[len(*grp)-1].Items)
-				}
-			}
-			// Replace the <h*> tag with a <span>
-			wrapper := &html.Node{
-				Data:     atom.Span.String(),
-				DataAtom: atom.Span,
-				Type:     html.ElementNode,
-			}
-			for child := n.FirstChild; child != nil; child = child.NextSibling {
-				child, err := clone(child)
-				if err != nil {
-					return err
-				}
-				wrapper.AppendChild(child)
-			}
-			var buf bytes.Buffer
-			if err := html.Render(&buf, wrapper); err != nil {
-				return err
-			}
-			*grp = append(*grp, tocVars{
-				Anchor: attr(n, atom.Id),
-				HTML:   template.HTML(buf.String()),
-			})
-		}
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			if err := f(c); err != nil {
-				return err
-			}
-		}
-		return nil
-	}
-	if err := f(doc.root); err != nil {
-		return fmt.Errorf("cannot recurse into HTML: %w", err)
-	}
-
-	tocPath := "_toc.html.tmpl"
-	tocbody, err := os.ReadFile(filepath.Join(doc.meta.TemplateDir, tocPath))
-	if err != nil {
-		return fmt.Errorf("cannot read toc for %q: %w", doc.meta.SourcePath, err)
-	}
-	toctmpl, err := template.New(tocPath).Parse(string(tocbody))
-	if err != nil {
-		return fmt.Errorf("cannot parse toc for %q: %w; %s", doc.meta.SourcePath, err, tocbody)
-	}
-	subtocPath := "_subtoc.html.tmpl"
-	subtocbody, err := os.ReadFile(filepath.Join(doc.meta.TemplateDir, subtocPath))
-	if err != nil {
-		return fmt.Errorf("cannot read subtoc for %q: %w", doc.meta.SourcePath, err)
-	}
-	if _, err := toctmpl.New(subtocPath).Parse(string(subtocbody)); err != nil {
-		return fmt.Errorf("cannot parse subtoc for %q: %w; %s", doc.meta.SourcePath, err, subtocbody)
-	}
-
-	var buf bytes.Buffer
-	if err := toctmpl.Execute(&buf, v); err != nil {
-		return err
-	}
-	toc, err := html.Parse(&buf)
-	if err != nil {
+// The rest of the chain keeps the page version loaded,
+// so rendering the page afterwards needn't load it again.
+// If the next document can't render a body it hasn't loaded,
+// the feed version is loaded into it for the render,
+// then the page version is loaded back.
+func (doc *HTMLDocument) renderFeed(w io.Writer) (err error) {
+	if next, ok := doc.next.(*TemplateDocument); ok {
+		return next.renderBody(w, doc.feedResult)
+	}
+	if err := doc.next.Load(bytes.NewReader(doc.feedResult)); err != nil {
 		return err
 	}
-
-	// Insert table of contents before first <h2> (i.e. after the introduction).
-	firstH2 := firstTag(doc.root, atom.H2)
-	if firstH2 == nil {
-		return fmt.Errorf(
-			"please add at least one H2 heading to %s in order to provide a table of contents anchor point",
-			doc.meta.SourcePath,
-		)
-	}
-	firstH2.Parent.InsertBefore(toc, firstH2)
-	return nil
+	defer func() {
+		if reloadErr := doc.next.Load(bytes.NewReader(doc.result)); reloadErr != nil && err == nil {
+			err = fmt.Errorf("cannot reload page version: %w", reloadErr)
+		}
+	}()
+	return doc.next.Render(w)
 }
 
 func (doc *HTMLDocument) replaceSpecialText() error {
@@ -370,21 +379,6 @@ func (doc *HTMLDocument) replaceSpecialText() error {
 	return nil
 }
 
-// setPreview extracts information needed for processing from the document's HTML.
-func (doc *HTMLDocument) setPreview() error {
-	if doc.meta.Preview != "" {
-		return nil
-	}
-	if p := firstTag(doc.root, atom.P); p != nil {
-		for child := p.FirstChild; child != nil && doc.meta.Preview == ""; child = child.NextSibling {
-			if child.Type == html.TextNode {
-				doc.meta.Preview = child.Data
-			}
-		}
-	}
-	return nil
-}
-
 // setTitle finds the first level-1 heading in the document,
 // sets the document title to its contents,
 // then removes it.
@@ -459,20 +453,6 @@ func attr(n *html.Node, attr atom.Atom) string {
 	return ""
 }
 
-// clone returns a deep copy of n.
-func clone(n *html.Node) (*html.Node, error) {
-	var buf bytes.Buffer
-	if err := html.Render(&buf, n); err != nil {
-		return nil, err
-	}
-	els, err := html.ParseFragment(&buf, n.Parent)
-	if err != nil {
-		return nil, err
-	}
-
-	return els[0], nil
-}
-
 // codeBlocks returns all code blocks in the document. A code block is defined
 // as a <code> tag which is a directy child of a <pre> tag.
 func codeBlocks(root *html.Node) map[*html.Node]struct{} {
@@ -500,49 +480,6 @@ func firstTag(n *html.Node, t atom.Atom) *html.Node {
 	return nil
 }
 
-func (doc *HTMLDocument) highlightCode() error {
-	for codeBlock := range codeBlocks(doc.root) {
-		lang := lang(codeBlock)
-		formatted, err := syntaxHighlight(lang, codeBlock.FirstChild.Data)
-		if err != nil {
-			return err
-		}
-
-		ancestry := doc.root
-		if ancestry.Type == html.DocumentNode {
-			ancestry = ancestry.FirstChild
-		}
-		pre, err := html.ParseFragment(strings.NewReader(formatted), ancestry)
-		if err != nil {
-			return fmt.Errorf("can't parse HTML %q: %w", formatted, err)
-		}
-		originalPre := codeBlock.Parent
-		for _, fragment := range pre {
-			if fragment.DataAtom == atom.Head {
-				continue
-			}
-			if fragment.DataAtom == atom.Body {
-				f := fragment.FirstChild
-				f.Parent = nil
-				originalPre.Parent.InsertBefore(f, originalPre)
-			}
-		}
-		originalPre.Parent.RemoveChild(originalPre)
-	}
-
-	return nil
-}
-
-func lang(code *html.Node) string {
-	for _, class := range strings.Fields(attr(code, atom.Class)) {
-		if _, l, ok := strings.Cut(class, "language-"); ok {
-			return l
-		}
-	}
-
-	return ""
-}
-
 func (doc *HTMLDocument) openExternalLinkInNewTab(a *html.Node) error {
 	var href *html.Attribute
 	for _, attr := range a.Attr {
@@ -581,35 +518,3 @@ func (doc *HTMLDocument) openExternalLinksInNewTab() error {
 	}
 	return nil
 }
-
-func syntaxHighlight(lang, code string) (string, error) {
-	// Determine lexer.
-	lexer := lexers.Get(lang)
-	if lexer == nil {
-		lexer = lexers.Analyse(code)
-	}
-	if lexer == nil {
-		lexer = lexers.Fallback
-	}
-	lexer = chroma.Coalesce(lexer)
-	formatter := chromahtml.New(
-		chromahtml.Standalone(false),
-		chromahtml.TabWidth(2),
-		chromahtml.WithClasses(true),
-		chromahtml.WithLineNumbers(true),
-	)
-
-	// This has ~no effect because we specify colors in style.css manually, and
-	// pass chromahtml.WithClasses(true) above, meaning no inline styles get added
-	s := styles.Get("dracula")
-	it, err := lexer.Tokenise(nil, code)
-	if err != nil {
-		return "", err
-	}
-
-	var buf bytes.Buffer
-	if err := formatter.Format(&buf, s, it); err != nil {
-		return "", err
-	}
-	return buf.String(), nil
-}
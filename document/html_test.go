@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"gotest.tools/v3/assert"
 )
@@ -14,12 +15,31 @@ func surround(html string) string {
 	return fmt.Sprintf("<html><head></head><body>%s</body></html>", html)
 }
 
+// loadAs loads input as a document in the format with the extension ext,
+// such as .md or .org,
+// that is built into an HTML document belonging to s.
+func loadAs(t *testing.T, ext, input string, s *Substructure) Document {
+	t.Helper()
+	src := filepath.Join("src", "test", "page"+ext)
+	meta := NewMetadata(src, filepath.Join("testdata", "templates"))
+	htm := NewHTMLDocument(src, meta, s, nil)
+	var doc Document = htm
+	switch ext {
+	case ".md":
+		doc = NewMarkdownDocument(src, meta, map[Document]struct{}{htm: {}})
+	case ".org":
+		doc = NewOrgDocument(src, meta, htm)
+	}
+	assert.NilError(t, doc.Load(strings.NewReader(input)))
+	return doc
+}
+
 func TestHTML(t *testing.T) {
 	for _, test := range []testCase{
 		{
 			name:     "Heading",
 			input:    "<h1>Heading 1</h1><h2>Heading 2</h2>",
-			expected: surround("<h2>Heading 2</h2>"),
+			expected: surround(`<h2 id="heading-2">Heading 2</h2>`),
 		},
 		{
 			name:     "SimpleTemplate",
@@ -43,6 +63,7 @@ func TestHTML(t *testing.T) {
 				src,
 				NewMetadata(src, filepath.Join("testdata", "templates")),
 				nil,
+				nil,
 			)
 			if err := doc.Load(strings.NewReader(test.input)); err != nil {
 				assert.NilError(t, err)
@@ -62,6 +83,7 @@ func TestHTMLTitleWithInlineFormatting(t *testing.T) {
 		src,
 		NewMetadata(src, filepath.Join("testdata", "templates")),
 		nil,
+		nil,
 	)
 
 	input := `<h1>What Makes <em>From</em> Soulslikes Different?</h1><p>Body</p>`
@@ -72,3 +94,54 @@ func TestHTMLTitleWithInlineFormatting(t *testing.T) {
 	assert.NilError(t, doc.Render(&actual))
 	assert.Equal(t, surround("<p>Body</p>"), actual.String())
 }
+
+func TestHTMLStats(t *testing.T) {
+	src := "src/test/Stats"
+	doc := NewHTMLDocument(
+		src,
+		NewMetadata(src, filepath.Join("testdata", "templates")),
+		&Substructure{cfg: &Config{WordsPerMinute: 4}},
+		nil,
+	)
+
+	input := `<h1>Not Counted</h1>
+<p>It's a well-known fact: {{ add 1 2 }} cats.</p>
+<h2>Photos</h2>
+<p><img src="/cat.jpg" alt="Cat"/>猫が好き</p>
+<pre><code>not counted either</code></pre>`
+	assert.NilError(t, doc.Load(strings.NewReader(input)))
+	assert.Equal(t, doc.Metadata().Stats, Stats{
+		CodeBlocks:  1,
+		Headings:    1,
+		Images:      1,
+		ReadingTime: 150 * time.Second,
+		Words:       10,
+	})
+	assert.Equal(t, doc.Metadata().Stats.Minutes(), 3)
+}
+
+func TestHTMLRenderFeed(t *testing.T) {
+	src := filepath.Join("src", "test", "feed.html")
+	meta := NewMetadata(src, filepath.Join("testdata", "templates"))
+	tmpl := NewTemplateDocument(src, meta, newTemplates(nil, nil, nil, nil), nil)
+	doc := NewHTMLDocument(src, meta, nil, tmpl)
+	assert.NilError(t, doc.Load(strings.NewReader(`<p>{{ "Page" }}</p>`)))
+	meta.Layout = ""
+	render := func() string {
+		var buf strings.Builder
+		assert.NilError(t, doc.Render(&buf))
+		return buf.String()
+	}
+
+	meta.feed = true
+	doc.feedResult = []byte(`<p>{{ "Feed" }}</p>`)
+	assert.Equal(t, render(), "<p>Feed</p>")
+	meta.feed = false
+	assert.Equal(t, render(), surround("<p>Page</p>"))
+
+	meta.feed = true
+	doc.feedResult = []byte(`<p>{{ broken }}</p>`)
+	assert.ErrorContains(t, doc.Render(&strings.Builder{}), "feed version")
+	meta.feed = false
+	assert.Equal(t, render(), surround("<p>Page</p>"))
+}
@@ -0,0 +1,210 @@
+package document // import "twos.dev/winter/document"
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"twos.dev/winter/graphic"
+)
+
+// galleryExts are the extensions of image references that may be gallery images,
+// in lowercase.
+var galleryExts = map[string]struct{}{
+	".jpeg": {},
+	".jpg":  {},
+	".webp": {},
+}
+
+// setResponsiveImages rewrites every <img> that shows a gallery image,
+// such as <img src="/img/2023/cat.jpg">,
+// to show its WebP output instead,
+// with a srcset of its thumbnails so browsers download only the size they need.
+// Its dimensions are also set,
+// so the page doesn't shift as it loads,
+// and it is loaded lazily.
+//
+// An image with dark and light variants,
+// such as cat-dark.jpg and cat-light.jpg,
+// is wrapped in a <picture> that shows the light variant
+// unless the reader prefers a dark color scheme,
+// whichever variant is referenced.
+//
+// A reference to a gallery image that doesn't exist fails the build,
+// unless a static file exists at that path.
+func (doc *HTMLDocument) setResponsiveImages() error {
+	if doc.s == nil {
+		return nil
+	}
+	for _, n := range allOfTypes(doc.root, map[atom.Atom]struct{}{atom.Img: {}}) {
+		src := attr(n, atom.Src)
+		ref, ok := galleryRef(src)
+		if !ok {
+			doc.pairStaticVariants(n)
+			continue
+		}
+		im, ok := doc.s.imgByRef(ref)
+		if !ok {
+			if _, err := os.Stat(filepath.Join("public", filepath.FromSlash(ref))); err == nil {
+				doc.pairStaticVariants(n)
+				continue
+			}
+			return fmt.Errorf("broken image %q in %s: no such image", src, doc.meta.SourcePath)
+		}
+		light, dark := im, im.Dark
+		if im.Light != nil {
+			light, dark = im.Light, im
+		}
+		for _, v := range []*img{light, dark} {
+			if v == nil {
+				continue
+			}
+			if err := doc.s.ensureIMG(v); err != nil {
+				return err
+			}
+			if len(v.Thumbnails) > 0 {
+				continue
+			}
+			if err := v.loadThumbnailMetadata(); err != nil {
+				return fmt.Errorf("cannot load thumbnails of %q for %s: %w", v.SourcePath, doc.meta.SourcePath, err)
+			}
+		}
+
+		setAttr(n, atom.Src, "/"+filepath.ToSlash(light.WebPath))
+		setAttr(n, atom.Srcset, light.srcset())
+		if attr(n, atom.Sizes) == "" {
+			setAttr(n, atom.Sizes, fmt.Sprintf("(max-width: %dpx) 100vw, %dpx", light.Width, light.Width))
+		}
+		if attr(n, atom.Width) == "" && attr(n, atom.Height) == "" {
+			setAttr(n, atom.Width, strconv.Itoa(light.Width))
+			setAttr(n, atom.Height, strconv.Itoa(light.Height))
+		}
+		// There is no atom for the loading attribute.
+		lazy := true
+		for _, a := range n.Attr {
+			if a.Key == "loading" {
+				lazy = false
+			}
+		}
+		if lazy {
+			n.Attr = append(n.Attr, html.Attribute{Key: "loading", Val: "lazy"})
+		}
+		if dark != nil {
+			wrapPicture(n, dark.srcset(), attr(n, atom.Sizes))
+		}
+	}
+	return nil
+}
+
+// pairStaticVariants wraps n,
+// an <img> showing a dark or light variant of a static image in public,
+// such as /diagram-dark.svg,
+// in a <picture> that shows the light variant
+// unless the reader prefers a dark color scheme.
+// If the image is a variant without a partner,
+// pairStaticVariants warns about it and leaves n as it is.
+func (doc *HTMLDocument) pairStaticVariants(n *html.Node) {
+	u, err := url.Parse(attr(n, atom.Src))
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" {
+		return
+	}
+	partner, dark, ok := graphic.Partner(graphic.SRC(u.Path))
+	if !ok {
+		return
+	}
+	if _, err := os.Stat(filepath.Join("public", filepath.FromSlash(path.Clean("/"+string(partner))))); err != nil {
+		slog.Warn(fmt.Sprintf("%s shows %s, which has no partner at %s.", doc.meta.SourcePath, u.Path, partner))
+		return
+	}
+	lightSrc, darkSrc := u.Path, string(partner)
+	if dark {
+		lightSrc, darkSrc = darkSrc, lightSrc
+	}
+	setAttr(n, atom.Src, lightSrc)
+	wrapPicture(n, darkSrc, attr(n, atom.Sizes))
+}
+
+// wrapPicture wraps n,
+// an <img> showing the light variant of an image,
+// in a <picture> that shows srcset instead when the reader prefers a dark color scheme.
+// If n is already in a <picture>,
+// it is left as it is.
+func wrapPicture(n *html.Node, srcset, sizes string) {
+	if n.Parent == nil || n.Parent.DataAtom == atom.Picture {
+		return
+	}
+	picture := &html.Node{Type: html.ElementNode, DataAtom: atom.Picture, Data: atom.Picture.String()}
+	source := &html.Node{
+		Type:     html.ElementNode,
+		DataAtom: atom.Source,
+		Data:     atom.Source.String(),
+		Attr: []html.Attribute{
+			{Key: atom.Media.String(), Val: "(prefers-color-scheme: dark)"},
+			{Key: atom.Srcset.String(), Val: srcset},
+		},
+	}
+	if sizes != "" {
+		setAttr(source, atom.Sizes, sizes)
+	}
+	n.Parent.InsertBefore(picture, n)
+	n.Parent.RemoveChild(n)
+	picture.AppendChild(source)
+	picture.AppendChild(n)
+}
+
+// galleryRef returns the path of the image at src relative to the site root,
+// such as img/2023/cat.jpg,
+// if src could refer to a gallery image.
+func galleryRef(src string) (string, bool) {
+	u, err := url.Parse(src)
+	if err != nil || u.Scheme != "" || u.Host != "" {
+		return "", false
+	}
+	// Pages are never in subdirectories,
+	// so relative and absolute paths are equivalent.
+	ref := strings.TrimPrefix(path.Clean("/"+u.Path), "/")
+	if !strings.HasPrefix(ref, "img/") || strings.HasPrefix(ref, "img/thumb/") {
+		return "", false
+	}
+	if _, ok := galleryExts[strings.ToLower(path.Ext(ref))]; !ok {
+		return "", false
+	}
+	return ref, true
+}
+
+// imgByRef returns the gallery image that ref,
+// a path relative to the site root,
+// refers to by either its source or its output.
+//
+// If no such image exists, ok is false.
+func (s *Substructure) imgByRef(ref string) (im *img, ok bool) {
+	webPath := strings.TrimSuffix(ref, path.Ext(ref)) + ".webp"
+	for _, gallery := range s.galleries {
+		for _, im := range gallery {
+			if filepath.ToSlash(im.WebPath) == webPath {
+				return im, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// srcset returns the value of a srcset attribute listing im and its thumbnails by width.
+func (im *img) srcset() string {
+	thumbs := append(thumbnails(nil), im.Thumbnails...)
+	sort.Sort(thumbs)
+	var candidates []string
+	for _, t := range thumbs {
+		candidates = append(candidates, fmt.Sprintf("/%s %dw", filepath.ToSlash(t.WebPath), t.Width))
+	}
+	candidates = append(candidates, fmt.Sprintf("/%s %dw", filepath.ToSlash(im.WebPath), im.Width))
+	return strings.Join(candidates, ", ")
+}
@@ -0,0 +1,126 @@
+package document // import "twos.dev/winter/document"
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestSetResponsiveImages(t *testing.T) {
+	tmp := t.TempDir()
+	cwd, err := os.Getwd()
+	assert.NilError(t, err)
+	assert.NilError(t, os.Chdir(tmp))
+	t.Cleanup(func() {
+		_ = os.Chdir(cwd)
+	})
+
+	src := filepath.Join("src", "img", "2023", "trip", "IMG_0385.JPG")
+	assert.NilError(t, os.MkdirAll(filepath.Dir(src), 0o755))
+	assert.NilError(t, copyFile(filepath.Join(cwd, "testdata", "IMG_0385.JPG"), src))
+	assert.NilError(t, os.MkdirAll(filepath.Join("public", "img"), 0o755))
+	// The light variant is in another source directory,
+	// and an ignored file is discovered before either.
+	for _, variant := range []string{
+		filepath.Join("src", "img", "2023", "trip", "cat-dark.JPG"),
+		filepath.Join("notes", "img", "2023", "trip", "cat-light.JPG"),
+		filepath.Join("src", "img", "2023", "zoo", "#scratch.JPG"),
+	} {
+		assert.NilError(t, os.MkdirAll(filepath.Dir(variant), 0o755))
+		assert.NilError(t, copyFile(src, variant))
+	}
+	for _, static := range []string{"static.jpg", "chart-dark.svg", "chart-light.svg", "lonely-dark.svg"} {
+		assert.NilError(t, os.WriteFile(filepath.Join("public", "img", static), nil, 0o644))
+	}
+
+	s := &Substructure{cfg: &Config{Dist: "dist", Src: []string{"notes"}}, docs: &documents{}}
+	assert.NilError(t, s.discover())
+	// Pretend every image is built so none are encoded just in time.
+	for _, gallery := range s.galleries {
+		for _, im := range gallery {
+			dest := filepath.Join("dist", im.WebPath)
+			assert.NilError(t, os.MkdirAll(filepath.Dir(dest), 0o755))
+			assert.NilError(t, os.WriteFile(dest, nil, 0o644))
+		}
+	}
+	dark, ok := s.imgByRef("img/2023/trip/cat-dark.jpg")
+	assert.Assert(t, ok)
+	assert.Assert(t, dark.Light != nil && dark.Light.Dark == dark)
+	tmpl := docFuncs{env: newTemplates(nil, nil, s.galleries, nil)}
+	assert.Equal(t, len(tmpl.galleryFunc("trip")), 2)
+
+	for _, test := range []struct {
+		name  string
+		input string
+		want  string
+		err   string
+	}{
+		{
+			name:  "Gallery",
+			input: `<img src="/img/2023/trip/IMG_0385.JPG" alt="Trip">`,
+			want:  `<img src="/img/2023/trip/IMG_0385.webp" alt="Trip" srcset="/img/thumb/2023/trip/IMG_0385.1x1.webp 1w, `,
+		},
+		{
+			name:  "Attributes",
+			input: `<img src="img/2023/trip/IMG_0385.webp" alt="Trip" loading="eager" width="100">`,
+			want:  `loading="eager" width="100" srcset="`,
+		},
+		{
+			name:  "Dimensions",
+			input: `<img src="/img/2023/trip/IMG_0385.JPG" alt="Trip">`,
+			want:  `/img/2023/trip/IMG_0385.webp 1280w" sizes="(max-width: 1280px) 100vw, 1280px" width="1280" height="1280" loading="lazy"/>`,
+		},
+		{
+			name:  "Static",
+			input: `<img src="/img/static.jpg" alt="">`,
+			want:  `<img src="/img/static.jpg" alt=""/>`,
+		},
+		{
+			name:  "External",
+			input: `<img src="https://example.com/img/cat.jpg" alt="">`,
+			want:  `<img src="https://example.com/img/cat.jpg" alt=""/>`,
+		},
+		{
+			name:  "Variants",
+			input: `<img src="/img/2023/trip/cat-dark.jpg" alt="Cat">`,
+			want:  `<picture><source media="(prefers-color-scheme: dark)" srcset="/img/thumb/2023/trip/cat-dark.1x1.webp 1w, `,
+		},
+		{
+			name:  "VariantsDefaultToLight",
+			input: `<img src="/img/2023/trip/cat-dark.jpg" alt="Cat">`,
+			want:  `<img src="/img/2023/trip/cat-light.webp" alt="Cat" srcset="/img/thumb/2023/trip/cat-light.1x1.webp 1w, `,
+		},
+		{
+			name:  "StaticVariants",
+			input: `<img src="/img/chart-dark.svg" alt="Chart">`,
+			want:  `<picture><source media="(prefers-color-scheme: dark)" srcset="/img/chart-dark.svg"/><img src="/img/chart-light.svg" alt="Chart"/></picture>`,
+		},
+		{
+			name:  "StaticVariantWithoutPartner",
+			input: `<img src="/img/lonely-dark.svg" alt="">`,
+			want:  `<img src="/img/lonely-dark.svg" alt=""/>`,
+		},
+		{
+			name:  "Broken",
+			input: `<img src="/img/2023/trip/missing.jpg" alt="">`,
+			err:   "broken image",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			src := filepath.Join("src", "test", "images.html")
+			doc := NewHTMLDocument(src, NewMetadata(src, filepath.Join(cwd, "testdata", "templates")), s, nil)
+			err := doc.Load(strings.NewReader(test.input))
+			if test.err != "" {
+				assert.ErrorContains(t, err, test.err)
+				return
+			}
+			assert.NilError(t, err)
+			var buf strings.Builder
+			assert.NilError(t, doc.Render(&buf))
+			assert.Assert(t, strings.Contains(buf.String(), test.want), buf.String())
+		})
+	}
+}
@@ -40,6 +40,16 @@ type img struct {
 	EXIF
 
 	Alt string
+	// Dark is the version of a light image for dark color schemes,
+	// paired by filename, as in cat-light.jpg and cat-dark.jpg.
+	// If the image has no dark variant, Dark is nil.
+	Dark *img
+	// Height is the height of the full-size image, in pixels.
+	Height int
+	// Light is the version of a dark image for light color schemes,
+	// paired by filename, as in cat-dark.jpg and cat-light.jpg.
+	// If the image has no light variant, Light is nil.
+	Light *img
 	// PurchaseURL is an optional external URL where the image can be purchased.
 	PurchaseURL string
 	Thumbnails  thumbnails
@@ -48,6 +58,8 @@ type img struct {
 	SourcePath string
 	// WebPath is the path component of the URL to the image as it will exist after building.
 	WebPath string
+	// Width is the width of the full-size image, in pixels.
+	Width int
 
 	cfg                      *Config
 	configuredPurchaseURL    string
@@ -82,8 +94,18 @@ func (t thumbnails) Swap(i, j int) {
 
 // NewIMG returns a struct that represents an image to be built.
 // The returned value implements [Document].
+//
+// Its web path mirrors its path within whichever source directory it is in,
+// so src/img/cat.jpg and notes/img/cat.jpg both build to img/cat.webp.
 func NewIMG(src string, cfg *Config) (*img, error) {
-	relpath, err := filepath.Rel("src", src)
+	dir := "src"
+	for _, d := range cfg.SourcePaths() {
+		if rel, err := filepath.Rel(d, src); err == nil && !strings.HasPrefix(rel, "..") {
+			dir = d
+			break
+		}
+	}
+	relpath, err := filepath.Rel(dir, src)
 	if err != nil {
 		return nil, fmt.Errorf("cannot get relative path for photo: %w", err)
 	}
@@ -498,6 +520,7 @@ func (im *img) populateThumbnails(
 		})
 	}
 	im.Thumbnails = thmbs
+	im.Width, im.Height = srcWidth, srcHeight
 	return nil
 }
 
@@ -0,0 +1,258 @@
+package document // import "twos.dev/winter/document"
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ansiEscape matches the terminal color codes Jupyter kernels write into error tracebacks.
+var ansiEscape = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// JupyterDocument represents a source file that is a Jupyter notebook.
+// Notebooks are never executed;
+// the outputs stored in them are shown as they are.
+//
+// JupyterDocument implements [Document].
+//
+// The JupyterDocument is transitory;
+// its only purpose is to create an [HTMLDocument].
+type JupyterDocument struct {
+	// SourcePath is the path on disk to the file this notebook is read from.
+	// The path is relative to the working directory.
+	SourcePath string
+
+	deps map[string]struct{}
+	meta *Metadata
+	// next is the HTML document generated from this notebook.
+	next Document
+}
+
+// notebook is a Jupyter notebook in nbformat 4,
+// as described at https://nbformat.readthedocs.io/en/latest/format_description.html.
+type notebook struct {
+	Cells    []notebookCell `json:"cells"`
+	Metadata map[string]any `json:"metadata"`
+	Format   int            `json:"nbformat"`
+}
+
+type notebookCell struct {
+	Attachments map[string]map[string]multiline `json:"attachments"`
+	Kind        string                          `json:"cell_type"`
+	Metadata    map[string]any                  `json:"metadata"`
+	Outputs     []notebookOutput                `json:"outputs"`
+	Source      multiline                       `json:"source"`
+}
+
+type notebookOutput struct {
+	Data      map[string]multiline `json:"data"`
+	Kind      string               `json:"output_type"`
+	Name      string               `json:"name"`
+	Text      multiline            `json:"text"`
+	Traceback []string             `json:"traceback"`
+}
+
+// multiline is a string that a notebook may store either whole or as a list of lines.
+type multiline string
+
+func (m *multiline) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*m = multiline(s)
+		return nil
+	}
+	var lines []string
+	if err := json.Unmarshal(b, &lines); err != nil {
+		return err
+	}
+	*m = multiline(strings.Join(lines, ""))
+	return nil
+}
+
+// outputPreference is the order in which to choose among the representations of a rich output.
+var outputPreference = []string{
+	"text/html",
+	"image/svg+xml",
+	"image/png",
+	"image/jpeg",
+	"image/gif",
+	"text/markdown",
+	"text/plain",
+}
+
+// NewJupyterDocument creates a new document whose original source is at path src.
+//
+// Nothing is read from disk; src is metadata.
+// To read and parse the notebook, call [Load].
+func NewJupyterDocument(src string, meta *Metadata, next Document) *JupyterDocument {
+	return &JupyterDocument{
+		SourcePath: src,
+
+		deps: map[string]struct{}{
+			"public/style.css": {},
+		},
+		meta: meta,
+		next: next,
+	}
+}
+
+func (doc *JupyterDocument) DependsOn(src string) bool {
+	if _, ok := doc.deps[src]; ok {
+		return true
+	}
+	return doc.next.DependsOn(src)
+}
+
+// Load reads a notebook from r and loads it into doc.
+//
+// Markdown cells are rendered as Markdown documents are.
+// Code cells become code blocks in the notebook's language,
+// followed by their stored outputs.
+// Top-level notebook metadata that names a frontmatter field,
+// such as date or type,
+// sets it.
+//
+// If called more than once, the last call wins.
+func (doc *JupyterDocument) Load(r io.Reader) error {
+	var nb notebook
+	if err := json.NewDecoder(r).Decode(&nb); err != nil {
+		return fmt.Errorf("cannot parse notebook %s: %w", doc.SourcePath, err)
+	}
+	if nb.Format < 4 {
+		return fmt.Errorf("cannot read notebook %s: nbformat %d is not supported; upgrade it to 4 with jupyter nbconvert --to notebook", doc.SourcePath, nb.Format)
+	}
+
+	keys := make([]string, 0, len(nb.Metadata))
+	for k := range nb.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		var v string
+		switch val := nb.Metadata[k].(type) {
+		case string:
+			v = val
+		case float64:
+			v = strconv.FormatFloat(val, 'f', -1, 64)
+		case bool:
+			v = strconv.FormatBool(val)
+		default:
+			continue
+		}
+		if err := doc.meta.setAttribute(k, v); err != nil {
+			return fmt.Errorf("cannot read notebook metadata %q of %s: %w", k, doc.SourcePath, err)
+		}
+	}
+
+	var cfg *Config
+	if htmlDoc, ok := doc.next.(*HTMLDocument); ok && htmlDoc.s != nil {
+		cfg = htmlDoc.s.cfg
+	}
+	exts, err := enabledMarkdownExtensions(cfg, doc.meta)
+	if err != nil {
+		return fmt.Errorf("cannot render Markdown cells of %s: %w", doc.SourcePath, err)
+	}
+
+	lang := notebookLanguage(nb.Metadata)
+	var htm bytes.Buffer
+	for _, cell := range nb.Cells {
+		switch cell.Kind {
+		case "markdown":
+			src := string(cell.Source)
+			for name, data := range cell.Attachments {
+				for mime, b64 := range data {
+					src = strings.ReplaceAll(src, "attachment:"+name, fmt.Sprintf("data:%s;base64,%s", mime, strings.TrimSpace(string(b64))))
+				}
+			}
+			htm.Write(renderMarkdown(moveFenceOptions([]byte(src)), exts))
+		case "code":
+			// Code and its outputs are shown as written,
+			// even where they look like Go templates.
+			if strings.TrimSpace(string(cell.Source)) != "" {
+				fmt.Fprintf(&htm, "<pre><code class=\"language-%s\" %s>%s</code></pre>\n", html.EscapeString(lang), literalAttr, html.EscapeString(string(cell.Source)))
+			}
+			var outputs strings.Builder
+			for _, out := range cell.Outputs {
+				writeNotebookOutput(&outputs, out, exts)
+			}
+			literalTemplates.WriteString(&htm, outputs.String())
+		case "raw":
+			if mime, _ := cell.Metadata["raw_mimetype"].(string); mime == "text/html" {
+				htm.WriteString(string(cell.Source))
+			}
+		}
+	}
+
+	return doc.next.Load(&htm)
+}
+
+func (doc *JupyterDocument) Metadata() *Metadata {
+	return doc.meta
+}
+
+func (doc *JupyterDocument) Render(w io.Writer) error {
+	return doc.next.Render(w)
+}
+
+// notebookLanguage returns the programming language of the code cells of a notebook with the given metadata.
+func notebookLanguage(meta map[string]any) string {
+	if info, ok := meta["language_info"].(map[string]any); ok {
+		if name, ok := info["name"].(string); ok && name != "" {
+			return name
+		}
+	}
+	if spec, ok := meta["kernelspec"].(map[string]any); ok {
+		if lang, ok := spec["language"].(string); ok && lang != "" {
+			return lang
+		}
+	}
+	return "python"
+}
+
+// writeNotebookOutput writes the HTML for a stored output of a code cell to w,
+// rendering any Markdown output with the extensions exts.
+// Of the representations of a rich output,
+// the first in outputPreference is used.
+func writeNotebookOutput(w io.Writer, out notebookOutput, exts []MarkdownExtension) {
+	switch out.Kind {
+	case "stream":
+		class := "output"
+		if out.Name == "stderr" {
+			class += " output-stderr"
+		}
+		fmt.Fprintf(w, "<pre class=\"%s\">%s</pre>\n", class, html.EscapeString(string(out.Text)))
+	case "error":
+		tb := ansiEscape.ReplaceAllString(strings.Join(out.Traceback, "\n"), "")
+		fmt.Fprintf(w, "<pre class=\"output output-error\">%s</pre>\n", html.EscapeString(tb))
+	case "display_data", "execute_result":
+		for _, mime := range outputPreference {
+			data, ok := out.Data[mime]
+			if !ok {
+				continue
+			}
+			switch mime {
+			case "text/html", "image/svg+xml":
+				fmt.Fprintf(w, "<div class=\"output\">%s</div>\n", data)
+			case "text/markdown":
+				fmt.Fprintf(w, "<div class=\"output\">%s</div>\n", renderMarkdown([]byte(data), exts))
+			case "text/plain":
+				fmt.Fprintf(w, "<pre class=\"output\">%s</pre>\n", html.EscapeString(string(data)))
+			default:
+				fmt.Fprintf(
+					w,
+					"<div class=\"output\"><img src=\"data:%s;base64,%s\" alt=\"%s\"></div>\n",
+					mime,
+					strings.ReplaceAll(strings.TrimSpace(string(data)), "\n", ""),
+					html.EscapeString(string(out.Data["text/plain"])),
+				)
+			}
+			return
+		}
+	}
+}
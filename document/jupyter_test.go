@@ -0,0 +1,80 @@
+package document // import "twos.dev/winter/document"
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestJupyter(t *testing.T) {
+	src := filepath.Join("testdata", "analysis.ipynb")
+	meta := NewMetadata(src, filepath.Join("testdata", "templates"))
+	doc := NewJupyterDocument(src, meta, NewHTMLDocument(src, meta, nil, nil))
+	f, err := os.Open(src)
+	assert.NilError(t, err)
+	defer f.Close()
+	assert.NilError(t, doc.Load(f))
+
+	assert.Equal(t, meta.Title, "Kiln Temperatures")
+	assert.Equal(t, meta.CreatedAt, time.Date(2024, time.May, 6, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, meta.Kind, post)
+	assert.Equal(t, meta.Series, "Building a Kiln")
+	assert.Equal(t, meta.SeriesOrder, 4)
+
+	var buf strings.Builder
+	assert.NilError(t, doc.Render(&buf))
+	got := buf.String()
+	for _, want := range []string{
+		`<p>We logged the kiln every <strong>minute</strong>.</p>`,
+		`<img src="data:image/png;base64,iVBORw0KGgo=" alt="Logger"/>`,
+		`<pre tabindex="0" class="chroma">`,
+		`<span class="nb">print</span>`,
+		`<pre class="output">1200
+</pre>`,
+		`<img src="data:image/png;base64,iVBORw0KGgo=" alt="&lt;Figure size 640x480 with 1 Axes&gt;"/>`,
+		`<svg><circle r="1"></circle></svg>`,
+		`<table><tbody><tr><td>1200</td></tr></tbody></table>`,
+		`<pre class="output output-error">ZeroDivisionError: division by zero</pre>`,
+	} {
+		assert.Assert(t, strings.Contains(got, want), "missing %s in %s", want, got)
+	}
+	assert.Assert(t, !strings.Contains(got, "   max"), "plain text shown alongside HTML output")
+}
+
+func TestJupyterOldFormat(t *testing.T) {
+	src := filepath.Join("src", "test", "old.ipynb")
+	meta := NewMetadata(src, filepath.Join("testdata", "templates"))
+	doc := NewJupyterDocument(src, meta, NewHTMLDocument(src, meta, nil, nil))
+	err := doc.Load(strings.NewReader(`{"nbformat": 3, "worksheets": []}`))
+	assert.ErrorContains(t, err, "nbformat 3")
+}
+
+func TestJupyterTemplateBraces(t *testing.T) {
+	src := filepath.Join("src", "test", "braces.ipynb")
+	meta := NewMetadata(src, filepath.Join("testdata", "templates"))
+	doc := NewJupyterDocument(src, meta, NewHTMLDocument(src, meta, nil,
+		NewTemplateDocument(src, meta, newTemplates(nil, nil, nil, nil), nil),
+	))
+	assert.NilError(t, doc.Load(strings.NewReader(`{
+  "cells": [
+    {
+      "cell_type": "code",
+      "metadata": {},
+      "source": ["x = 1\n", "print(f\"{{x}} is {x}\")"],
+      "outputs": [{"output_type": "stream", "name": "stdout", "text": ["{{x}} is 1\n"]}]
+    }
+  ],
+  "metadata": {"title": "Braces"},
+  "nbformat": 4
+}`)))
+	meta.Layout = ""
+	var buf strings.Builder
+	assert.NilError(t, doc.Render(&buf))
+	got := buf.String()
+	assert.Assert(t, strings.Contains(got, `<span class="se">{{</span><span class="s2">x</span><span class="se">}}</span>`), got)
+	assert.Assert(t, strings.Contains(got, `<pre class="output">{{x}} is 1`), got)
+}
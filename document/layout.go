@@ -3,9 +3,7 @@ package document // import "twos.dev/winter/document"
 import (
 	"bytes"
 	"fmt"
-	"html/template"
 	"io"
-	"os"
 	"path/filepath"
 	"strings"
 )
@@ -19,16 +17,19 @@ import (
 //
 // The LayoutDocument's job is to facilitate that embedding.
 // It will usually come last in the load/render chain.
+//
+// Layouts are rendered in the substructure's template environment,
+// so they can use the same functions and partials as document bodies.
 type LayoutDocument struct {
+	docFuncs
 	body []byte
-	meta *Metadata
 	next Document
 }
 
-func NewLayoutDocument(src string, meta *Metadata, next Document) *LayoutDocument {
+func NewLayoutDocument(src string, meta *Metadata, tmpls *templates, next Document) *LayoutDocument {
 	return &LayoutDocument{
-		meta: meta,
-		next: next,
+		docFuncs: docFuncs{env: tmpls, meta: meta},
+		next:     next,
 	}
 }
 
@@ -57,23 +58,9 @@ func (doc *LayoutDocument) Render(w io.Writer) error {
 		}
 		return nil
 	}
-	layoutBytes, err := os.ReadFile(doc.meta.Layout)
-	if err != nil {
-		return fmt.Errorf("cannot read %q to execute %q: %w", doc.Metadata().Layout, doc.Metadata().SourcePath, err)
-	}
-	if len(layoutBytes) == 0 {
-		return fmt.Errorf("attempt to render %q using layout %q resulted in 0 bytes rendered", doc.meta.SourcePath, doc.meta.Layout)
-	}
-	funcs := doc.meta.funcmap()
-	tlayout, err := template.New(doc.meta.Layout).Funcs(funcs).Parse(string(layoutBytes))
+	tlayout, _, err := doc.env.document(doc.meta, doc.body)
 	if err != nil {
-		return fmt.Errorf("cannot read layout %q to execute %q: %w", doc.meta.Layout, doc.meta.SourcePath, err)
-	}
-	if _, err = tlayout.New("body").Funcs(funcs).Parse(string(doc.body)); err != nil {
-		return fmt.Errorf("cannot parse template body %q: %w", doc.meta.SourcePath, err)
-	}
-	if err := loadDeps(tmplPath, tlayout); err != nil {
-		return fmt.Errorf("cannot load template dependencies for %q in layout %q: %w", doc.meta.SourcePath, doc.meta.Layout, err)
+		return fmt.Errorf("cannot prepare layout document %q with layout %q: %w", doc.meta.SourcePath, doc.meta.Layout, err)
 	}
 	if err := tlayout.Execute(w, doc.meta); err != nil {
 		return fmt.Errorf("cannot execute layout document %q with layout %q: %w", doc.meta.SourcePath, doc.meta.Layout, err)
@@ -0,0 +1,329 @@
+package document // import "twos.dev/winter/document"
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html/atom"
+)
+
+// graphPath is the path, relative to dist, of the JSON file describing the link graph.
+const graphPath = "graph.json"
+
+// linkGraph records which documents link to which other documents.
+// Documents are identified by web path,
+// so links to documents that have not been loaded yet are still recorded.
+type linkGraph struct {
+	// out maps the web path of each built document to the set of web paths it links to.
+	out map[string]map[string]struct{}
+}
+
+// targets returns the set of web paths the document at webPath links to.
+func (g *linkGraph) targets(webPath string) map[string]struct{} {
+	return g.out[webPath]
+}
+
+// set replaces the links of the document at webPath with targets.
+// It returns the web paths whose backlinks changed as a result.
+func (g *linkGraph) set(webPath string, targets map[string]struct{}) map[string]struct{} {
+	if g.out == nil {
+		g.out = map[string]map[string]struct{}{}
+	}
+	changed := map[string]struct{}{}
+	for old := range g.out[webPath] {
+		if _, ok := targets[old]; !ok {
+			changed[old] = struct{}{}
+		}
+	}
+	for target := range targets {
+		if _, ok := g.out[webPath][target]; !ok {
+			changed[target] = struct{}{}
+		}
+	}
+	g.out[webPath] = targets
+	return changed
+}
+
+// sources returns the web paths of the documents that link to the document at webPath.
+func (g *linkGraph) sources(webPath string) []string {
+	var srcs []string
+	for src, targets := range g.out {
+		if _, ok := targets[webPath]; ok && src != webPath {
+			srcs = append(srcs, src)
+		}
+	}
+	sort.Strings(srcs)
+	return srcs
+}
+
+// collectLinks records the web paths of the internal documents doc links to in its metadata.
+//
+// Only links written in the document source are collected.
+// Links generated by templates,
+// such as those on a page listing every post,
+// are not known yet when HTML is massaged,
+// which keeps listing pages from appearing in every document's backlinks.
+func (doc *HTMLDocument) collectLinks() {
+	doc.meta.links = map[string]struct{}{}
+	for _, a := range allOfTypes(doc.root, map[atom.Atom]struct{}{atom.A: {}}) {
+		if webPath, ok := internalWebPath(attr(a, atom.Href)); ok {
+			doc.meta.links[webPath] = struct{}{}
+		}
+	}
+}
+
+// resolveSourceLinks rewrites links that point to source files,
+// such as [text](other-post.md) in Markdown,
+// into links to the web paths of the documents built from those files.
+// This keeps sources portable,
+// since the same links work in editors and on code hosts.
+//
+// Relative links are resolved against the linking document's directory,
+// and absolute links against each source directory in turn.
+// A link to a source file that is not a known document is an error.
+//
+// If the document does not belong to a substructure,
+// resolveSourceLinks does nothing.
+func (doc *HTMLDocument) resolveSourceLinks() error {
+	if doc.s == nil {
+		return nil
+	}
+	for _, a := range allOfTypes(doc.root, map[atom.Atom]struct{}{atom.A: {}}) {
+		for i, at := range a.Attr {
+			if at.Key != atom.Href.String() {
+				continue
+			}
+			src, fragment, ok := sourceLinkPath(at.Val)
+			if !ok {
+				continue
+			}
+			target, ok := doc.s.docBySourceLink(doc.meta.SourcePath, src)
+			if !ok {
+				return fmt.Errorf("broken link to %q in %s: no such document", at.Val, doc.meta.SourcePath)
+			}
+			webPath := webPathOf(target)
+			if fragment != "" {
+				webPath += "#" + fragment
+			}
+			a.Attr[i].Val = webPath
+		}
+	}
+	return nil
+}
+
+// sourceLinkPath returns the file path href points to,
+// if href points to a source file rather than a web page,
+// along with any fragment.
+// The path may name one of several documents in the file,
+// as in notes.org::kiln.
+func sourceLinkPath(href string) (src, fragment string, ok bool) {
+	if href == "" || strings.Contains(href, string(templateStart)) {
+		return "", "", false
+	}
+	href, name, _ := strings.Cut(href, subdocumentSep)
+	u, err := url.Parse(href)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" {
+		return "", "", false
+	}
+	ext := path.Ext(u.Path)
+	if !isTextDocExt(ext) || ext == ".htm" || ext == htmlSuffix {
+		return "", "", false
+	}
+	src, fragment = filepath.FromSlash(u.Path), u.Fragment
+	if name != "" {
+		name, fragment, _ = strings.Cut(name, "#")
+		src += subdocumentSep + name
+	}
+	return src, fragment, true
+}
+
+// docBySourceLink returns the document built from the source file at src,
+// as linked to from the document whose source is at from.
+//
+// A relative src is relative to the directory of from.
+// An absolute src is relative to any source directory.
+func (s *Substructure) docBySourceLink(from, src string) (Document, bool) {
+	if !filepath.IsAbs(src) {
+		return s.docBySourceFile(filepath.Join(filepath.Dir(from), src))
+	}
+	for _, dir := range s.cfg.SourcePaths() {
+		if doc, ok := s.docBySourceFile(filepath.Join(dir, src)); ok {
+			return doc, true
+		}
+	}
+	return nil, false
+}
+
+// docBySourceFile returns the document built from the source file at src,
+// or from the document in it named after :: in src,
+// as in notes.org::kiln.
+//
+// A file split into several documents stands for the first of them,
+// and a name that isn't one of its documents',
+// such as an Org search option like notes.org::*Heading,
+// stands for the file.
+func (s *Substructure) docBySourceFile(src string) (Document, bool) {
+	if doc, ok := s.DocBySourcePath(src); ok {
+		return doc, true
+	}
+	file := filepath.Clean(sourceFile(src))
+	if doc, ok := s.DocBySourcePath(file); ok {
+		return doc, true
+	}
+	if srcs := s.splits[file]; len(srcs) > 0 {
+		return s.DocBySourcePath(srcs[0])
+	}
+	return nil, false
+}
+
+// webPathOf returns the web path doc will be built to.
+//
+// Frontmatter can change a document's web path,
+// which is known only once doc has been loaded;
+// until then, the web path its source file name implies is used.
+// A full build loads every document before building any,
+// so the pages it writes know the web path of every document they link to.
+func webPathOf(doc Document) string {
+	return "/" + strings.TrimPrefix(doc.Metadata().WebPath, "/")
+}
+
+// internalWebPath returns the web path of the document href points to,
+// if href points to a document on this website.
+// Since web paths are flat,
+// relative links are treated as if they were relative to the web root.
+func internalWebPath(href string) (string, bool) {
+	if href == "" || strings.Contains(href, string(templateStart)) {
+		return "", false
+	}
+	u, err := url.Parse(href)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" {
+		return "", false
+	}
+	p := path.Clean("/" + u.Path)
+	if !strings.HasSuffix(p, htmlSuffix) {
+		return "", false
+	}
+	return p, true
+}
+
+// docByWebPath returns the document that will be built to webPath.
+//
+// If no such document exists, ok is false.
+func (s *Substructure) docByWebPath(webPath string) (doc Document, ok bool) {
+	for _, doc := range s.docs.All {
+		if strings.TrimPrefix(doc.Metadata().WebPath, "/") == strings.TrimPrefix(webPath, "/") {
+			return doc, true
+		}
+	}
+	return nil, false
+}
+
+// updateLinks records the links of the freshly loaded doc in the link graph,
+// fills in its OutboundLinks and Backlinks,
+// and refreshes the Backlinks of any documents it now links to or no longer links to.
+//
+// It returns those other documents whose Backlinks changed and which have been built before,
+// so they can be rebuilt.
+func (s *Substructure) updateLinks(doc Document) []Document {
+	meta := doc.Metadata()
+	changed := s.links.set(meta.WebPath, meta.links)
+	meta.OutboundLinks = s.linkedDocuments(keys(s.links.targets(meta.WebPath)))
+	meta.Backlinks = s.backlinks(meta.WebPath)
+
+	var stale []Document
+	for webPath := range changed {
+		target, ok := s.docByWebPath(webPath)
+		if !ok || target == doc {
+			continue
+		}
+		target.Metadata().Backlinks = s.backlinks(target.Metadata().WebPath)
+		if _, built := s.links.out[target.Metadata().WebPath]; built {
+			stale = append(stale, target)
+		}
+	}
+	return stale
+}
+
+// backlinks returns the listed documents that link to the document at webPath,
+// most recent first.
+func (s *Substructure) backlinks(webPath string) []Document {
+	return s.linkedDocuments(s.links.sources(webPath))
+}
+
+// linkedDocuments returns the listed documents with the given web paths,
+// most recent first.
+// Web paths that no document builds to are skipped.
+func (s *Substructure) linkedDocuments(webPaths []string) []Document {
+	now := s.cfg.Now()
+	docs := &documents{}
+	for _, webPath := range webPaths {
+		doc, ok := s.docByWebPath(webPath)
+		if !ok || !doc.Metadata().ListedAt(now, s.cfg.Future) {
+			continue
+		}
+		docs.add(doc)
+	}
+	sort.Sort(docs)
+	return docs.All
+}
+
+// writeGraph writes the link graph between documents to dist as JSON,
+// for use by visualizations.
+//
+// The format is a list of nodes and a list of links between them:
+//
+//	{
+//	  "nodes": [{"id": "/a.html", "title": "A"}, {"id": "/b.html", "title": "B"}],
+//	  "links": [{"source": "/a.html", "target": "/b.html"}]
+//	}
+func (s *Substructure) writeGraph(dist string) error {
+	type node struct {
+		ID    string `json:"id"`
+		Title string `json:"title"`
+	}
+	type link struct {
+		Source string `json:"source"`
+		Target string `json:"target"`
+	}
+	graph := struct {
+		Nodes []node `json:"nodes"`
+		Links []link `json:"links"`
+	}{Nodes: []node{}, Links: []link{}}
+
+	now := s.cfg.Now()
+	for _, src := range keys(s.links.out) {
+		doc, ok := s.docByWebPath(src)
+		if !ok || !doc.Metadata().ListedAt(now, s.cfg.Future) {
+			continue
+		}
+		graph.Nodes = append(graph.Nodes, node{ID: src, Title: doc.Metadata().Title})
+		for _, target := range s.linkedDocuments(keys(s.links.targets(src))) {
+			graph.Links = append(graph.Links, link{Source: src, Target: target.Metadata().WebPath})
+		}
+	}
+
+	b, err := json.MarshalIndent(graph, "", "  ")
+	if err != nil {
+		return fmt.Errorf("cannot encode link graph: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dist, graphPath), b, 0o644); err != nil {
+		return fmt.Errorf("cannot write link graph: %w", err)
+	}
+	return nil
+}
+
+// keys returns the keys of m, sorted.
+func keys[V any](m map[string]V) []string {
+	k := make([]string, 0, len(m))
+	for key := range m {
+		k = append(k, key)
+	}
+	sort.Strings(k)
+	return k
+}
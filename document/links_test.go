@@ -0,0 +1,175 @@
+package document // import "twos.dev/winter/document"
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestInternalWebPath(t *testing.T) {
+	for _, test := range []struct {
+		href string
+		want string
+		ok   bool
+	}{
+		{href: "/cat.html", want: "/cat.html", ok: true},
+		{href: "cat.html", want: "/cat.html", ok: true},
+		{href: "/cat.html#whiskers", want: "/cat.html", ok: true},
+		{href: "#whiskers"},
+		{href: "https://example.com/cat.html"},
+		{href: "mailto:cat@example.com"},
+		{href: "/img/cat.webp"},
+		{href: "{{ .WebPath }}"},
+	} {
+		got, ok := internalWebPath(test.href)
+		assert.Equal(t, ok, test.ok, test.href)
+		assert.Equal(t, got, test.want, test.href)
+	}
+}
+
+func TestHTMLDocumentCollectsLinks(t *testing.T) {
+	src := "src/test/Links"
+	doc := NewHTMLDocument(src, NewMetadata(src, filepath.Join("testdata", "templates")), nil, nil)
+	assert.NilError(t, doc.Load(strings.NewReader(
+		`<p><a href="/dog.html">Dog</a>, <a href="bird.html#wings">bird</a>, and <a href="https://example.com">elsewhere</a>.</p>`,
+	)))
+	assert.DeepEqual(t, keys(doc.Metadata().links), []string{"/bird.html", "/dog.html"})
+}
+
+func TestSubstructureUpdateLinks(t *testing.T) {
+	cat := testDocument("Cat", post, time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC))
+	dog := testDocument("Dog", post, time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC))
+	for _, doc := range []Document{cat, dog} {
+		doc.Metadata().WebPath = "/" + doc.Metadata().WebPath
+		doc.Metadata().links = map[string]struct{}{}
+	}
+	s := Substructure{cfg: &Config{}, docs: &documents{All: []Document{cat, dog}}}
+
+	assert.Equal(t, len(s.updateLinks(dog)), 0)
+
+	cat.Metadata().links = map[string]struct{}{dog.Metadata().WebPath: {}}
+	stale := s.updateLinks(cat)
+	assert.Equal(t, len(stale), 1)
+	assert.Equal(t, stale[0], dog)
+	assert.Equal(t, len(cat.Metadata().OutboundLinks), 1)
+	assert.Equal(t, cat.Metadata().OutboundLinks[0], dog)
+	assert.Equal(t, len(dog.Metadata().Backlinks), 1)
+	assert.Equal(t, dog.Metadata().Backlinks[0], cat)
+
+	cat.Metadata().links = map[string]struct{}{}
+	stale = s.updateLinks(cat)
+	assert.Equal(t, len(stale), 1)
+	assert.Equal(t, stale[0], dog)
+	assert.Equal(t, len(dog.Metadata().Backlinks), 0)
+}
+
+// countingDocument is a document that counts how many times it is loaded.
+type countingDocument struct {
+	Document
+	loads int
+}
+
+func (doc *countingDocument) Load(r io.Reader) error {
+	doc.loads++
+	return doc.Document.Load(r)
+}
+
+func TestSubstructureBuildDocs(t *testing.T) {
+	dir := t.TempDir()
+	s := &Substructure{cfg: &Config{Dist: filepath.Join(dir, "dist")}, docs: &documents{}}
+	for name, body := range map[string]string{
+		"cat.html": `<p><a href="/dog.html">Dog</a></p>`,
+		"dog.html": `<p>Woof.</p>`,
+	} {
+		src := filepath.Join(dir, name)
+		assert.NilError(t, os.WriteFile(src, []byte(body), 0o644))
+		meta := NewMetadata(src, filepath.Join("testdata", "templates"))
+		meta.GeminiPath = ""
+		s.docs.add(&countingDocument{Document: NewHTMLDocument(src, meta, s, nil)})
+	}
+
+	built, err := s.buildDocs()
+	assert.NilError(t, err)
+	assert.Equal(t, len(built), 2)
+	assert.DeepEqual(t, s.links.sources("/dog.html"), []string{"/cat.html"})
+	for _, doc := range s.docs.All {
+		assert.Equal(t, doc.(*countingDocument).loads, 1, doc.Metadata().WebPath)
+		_, err := os.Stat(filepath.Join(s.cfg.Dist, doc.Metadata().WebPath))
+		assert.NilError(t, err)
+	}
+	dog, _ := s.docByWebPath("/dog.html")
+	assert.Equal(t, len(dog.Metadata().Backlinks), 1)
+	assert.Equal(t, len(s.updateLinks(dog)), 0)
+}
+
+func TestHTMLDocumentResolvesSourceLinks(t *testing.T) {
+	cat := testDocument("Cat", post, time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC))
+	cat.Metadata().SourcePath = filepath.Join("src", "test", "cat.md")
+	cat.Metadata().WebPath = "/whiskers.html"
+	dog := testDocument("Dog", post, time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC))
+	dog.Metadata().SourcePath = filepath.Join("src", "test", "dog.org")
+	dog.Metadata().WebPath = "/dog.html"
+	kiln := testDocument("Kiln", post, time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC))
+	kiln.Metadata().SourcePath = filepath.Join("src", "test", "notes.org") + "::kiln"
+	kiln.Metadata().WebPath = "/kiln.html"
+	firing := testDocument("Firing", post, time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC))
+	firing.Metadata().SourcePath = filepath.Join("src", "test", "notes.org") + "::firing"
+	firing.Metadata().WebPath = "/firing.html"
+	s := &Substructure{
+		cfg:  &Config{},
+		docs: &documents{All: []Document{cat, dog, kiln, firing}},
+		splits: map[string][]string{
+			filepath.Join("src", "test", "notes.org"): {
+				kiln.Metadata().SourcePath,
+				firing.Metadata().SourcePath,
+			},
+		},
+	}
+
+	for _, test := range []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "Relative", body: `<a href="cat.md">Cat</a>`, want: `<a href="/whiskers.html">Cat</a>`},
+		{name: "Absolute", body: `<a href="/test/cat.md">Cat</a>`, want: `<a href="/whiskers.html">Cat</a>`},
+		{name: "Fragment", body: `<a href="cat.md#tail">Cat</a>`, want: `<a href="/whiskers.html#tail">Cat</a>`},
+		{name: "WebPath", body: `<a href="/dog.html">Dog</a>`, want: `<a href="/dog.html">Dog</a>`},
+		{name: "Split", body: `<a href="notes.org">Notes</a>`, want: `<a href="/kiln.html">Notes</a>`},
+		{name: "Subtree", body: `<a href="notes.org::firing#cones">Firing</a>`, want: `<a href="/firing.html#cones">Firing</a>`},
+		{name: "SearchOption", body: `<a href="notes.org::*Shopping">Notes</a>`, want: `<a href="/kiln.html">Notes</a>`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			src := filepath.Join("src", "test", "links.md")
+			doc := NewHTMLDocument(src, NewMetadata(src, filepath.Join("testdata", "templates")), s, nil)
+			assert.NilError(t, doc.Load(strings.NewReader(test.body)))
+			var buf strings.Builder
+			assert.NilError(t, doc.Render(&buf))
+			assert.Assert(t, strings.Contains(buf.String(), test.want), buf.String())
+		})
+	}
+
+	t.Run("Org", func(t *testing.T) {
+		src := filepath.Join("src", "test", "links.org")
+		meta := NewMetadata(src, filepath.Join("testdata", "templates"))
+		htm := NewHTMLDocument(src, meta, s, nil)
+		doc := NewOrgDocument(src, meta, htm)
+		assert.NilError(t, doc.Load(strings.NewReader("See [[file:dog.org][Dog]], [[./cat.md][Cat]], and [[notes.org::firing][Firing]].")))
+		var buf strings.Builder
+		assert.NilError(t, doc.Render(&buf))
+		assert.Assert(t, strings.Contains(buf.String(), `<a href="/dog.html">Dog</a>`), buf.String())
+		assert.Assert(t, strings.Contains(buf.String(), `<a href="/whiskers.html">Cat</a>`), buf.String())
+		assert.Assert(t, strings.Contains(buf.String(), `<a href="/firing.html">Firing</a>`), buf.String())
+	})
+
+	t.Run("Broken", func(t *testing.T) {
+		src := filepath.Join("src", "test", "links.md")
+		doc := NewHTMLDocument(src, NewMetadata(src, filepath.Join("testdata", "templates")), s, nil)
+		assert.ErrorContains(t, doc.Load(strings.NewReader(`<a href="bird.md">Bird</a>`)), "broken link")
+	})
+}
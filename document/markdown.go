@@ -3,8 +3,10 @@ package document // import "twos.dev/winter/document"
 import (
 	"bytes"
 	"fmt"
+	"html"
 	"io"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/gomarkdown/markdown"
@@ -21,6 +23,14 @@ var mdrepl = map[string][]byte{
 var (
 	templateStart = []byte("{{")
 	templateEnd   = []byte("}}")
+
+	// fenceLine matches a line that opens or closes a fenced code block,
+	// capturing its fence and anything after it.
+	fenceLine = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})(.*)$")
+	// fenceWithOptions matches the opening line of a fenced code block
+	// whose language is followed by highlighting options,
+	// as in ```go {linenos=false}.
+	fenceWithOptions = regexp.MustCompile(`^( {0,3})(` + "`{3,}" + `|~{3,})[ \t]*([^\s{}` + "`" + `]+)[ \t]+\{([^}\n]*)\}[ \t]*$`)
 )
 
 // MarkdownDocument represents a source file written in Markdown,
@@ -87,17 +97,62 @@ func (doc *MarkdownDocument) Load(r io.Reader) error {
 		return fmt.Errorf("cannot load template frontmatter for %q: %w", doc.meta.SourcePath, err)
 	}
 
-	mdbody2 := make([]byte, len(mdbody1))
-	copy(mdbody2, mdbody1)
-	if err := doc.loadForGemini(mdbody1); err != nil {
+	exts, err := enabledMarkdownExtensions(doc.config(), doc.meta)
+	if err != nil {
+		return fmt.Errorf("cannot render Markdown in %s: %w", doc.meta.SourcePath, err)
+	}
+
+	if err := doc.loadForGemini(dropFenceOptions(mdbody1)); err != nil {
 		return err
 	}
-	if err := doc.loadForHTML(mdbody2); err != nil {
+	if err := doc.loadForHTML(moveFenceOptions(mdbody1), exts); err != nil {
 		return err
 	}
 	return nil
 }
 
+// rewriteFenceOptions rewrites the opening line of each fenced code block in md
+// whose language is followed by highlighting options,
+// expanding repl as in [regexp.Regexp.Expand] with
+// $1 as its indentation, $2 as its fence, $3 as its language, and $4 as its options.
+// Lines inside fenced code blocks are left alone.
+// A new slice is returned;
+// md is not modified.
+func rewriteFenceOptions(md []byte, repl string) []byte {
+	lines := bytes.SplitAfter(md, []byte("\n"))
+	var fence []byte // the fence of the code block being read, if any
+	for i, line := range lines {
+		m := fenceLine.FindSubmatch(bytes.TrimRight(line, "\r\n"))
+		if m == nil || (m[1][0] == '`' && bytes.ContainsRune(m[2], '`')) {
+			continue
+		}
+		if fence != nil {
+			if m[1][0] == fence[0] && len(m[1]) >= len(fence) && len(bytes.TrimSpace(m[2])) == 0 {
+				fence = nil
+			}
+			continue
+		}
+		fence = m[1]
+		eol := line[len(bytes.TrimRight(line, "\r\n")):]
+		lines[i] = append(fenceWithOptions.ReplaceAll(bytes.TrimSuffix(line, eol), []byte(repl)), eol...)
+	}
+	return bytes.Join(lines, nil)
+}
+
+// moveFenceOptions moves the highlighting options of each fenced code block in md
+// into the braces the Markdown parser understands,
+// so ```go {linenos=false} becomes ```{go linenos=false}.
+func moveFenceOptions(md []byte) []byte {
+	return rewriteFenceOptions(md, "$1$2{$3 $4}")
+}
+
+// dropFenceOptions removes the highlighting options of each fenced code block in md,
+// which mean nothing in gemtext,
+// so ```go {linenos=false} becomes ```go.
+func dropFenceOptions(md []byte) []byte {
+	return rewriteFenceOptions(md, "$1$2$3")
+}
+
 func (doc *MarkdownDocument) loadForGemini(mdbody []byte) error {
 	gemtext, err := gemini.RenderMarkdown(mdbody, gemini.Defaults)
 	if err != nil {
@@ -114,24 +169,8 @@ func (doc *MarkdownDocument) loadForGemini(mdbody []byte) error {
 	return nil
 }
 
-func (doc *MarkdownDocument) loadForHTML(mdbody []byte) error {
-	p := parser.NewWithExtensions(
-		parser.Attributes |
-			parser.Autolink |
-			parser.FencedCode |
-			parser.Footnotes |
-			parser.HeadingIDs |
-			parser.MathJax |
-			parser.Strikethrough |
-			parser.Tables,
-	)
-	p.Opts.ParserHook = parserHook
-
-	byts := markdown.ToHTML(mdbody, p, newRenderer())
-	for old, new := range mdrepl {
-		byts = bytes.ReplaceAll(byts, []byte(old), new)
-	}
-	doc.html = byts
+func (doc *MarkdownDocument) loadForHTML(mdbody []byte, exts []MarkdownExtension) error {
+	doc.html = renderMarkdown(mdbody, exts)
 	if doc.next == nil {
 		return nil
 	}
@@ -145,6 +184,62 @@ func (doc *MarkdownDocument) loadForHTML(mdbody []byte) error {
 	return nil
 }
 
+// config returns the configuration of the site doc is part of,
+// or nil if it is not part of one.
+func (doc *MarkdownDocument) config() *Config {
+	for next := range doc.next {
+		if htmlDoc, ok := next.(*HTMLDocument); ok && htmlDoc.s != nil {
+			return htmlDoc.s.cfg
+		}
+	}
+	return nil
+}
+
+// renderMarkdown renders the Markdown mdbody into HTML with the extensions exts,
+// leaving any Go template syntax in it untouched.
+func renderMarkdown(mdbody []byte, exts []MarkdownExtension) []byte {
+	var extensions parser.Extensions
+	var flags mdhtml.Flags
+	blockHooks := []parser.BlockFunc{parserHook}
+	var renderHooks []mdhtml.RenderNodeFunc
+	for _, ext := range exts {
+		extensions |= ext.Parser
+		flags |= ext.Flags
+		if ext.ParseBlock != nil {
+			blockHooks = append(blockHooks, ext.ParseBlock)
+		}
+		if ext.RenderNode != nil {
+			renderHooks = append(renderHooks, ext.RenderNode)
+		}
+	}
+	if flags&mdhtml.Smartypants != 0 {
+		renderHooks = append(renderHooks, smartypantsHook(flags))
+	}
+
+	p := parser.NewWithExtensions(extensions)
+	p.Opts.ParserHook = func(data []byte) (ast.Node, []byte, int) {
+		for _, hook := range blockHooks {
+			if node, inner, consumed := hook(data); consumed > 0 {
+				return node, inner, consumed
+			}
+		}
+		return nil, nil, 0
+	}
+
+	root := p.Parse(mdbody)
+	ast.WalkFunc(root, func(node ast.Node, entering bool) ast.WalkStatus {
+		if block, ok := node.(*ast.CodeBlock); ok && entering {
+			setHighlightOptions(block)
+		}
+		return ast.GoToNext
+	})
+	byts := markdown.Render(root, newRenderer(flags, renderHooks))
+	for old, new := range mdrepl {
+		byts = bytes.ReplaceAll(byts, []byte(old), new)
+	}
+	return byts
+}
+
 func (doc *MarkdownDocument) Metadata() *Metadata {
 	return doc.meta
 }
@@ -183,13 +278,88 @@ func (doc *MarkdownDocument) RenderGemini(w io.Writer) error {
 	return nil
 }
 
-func newRenderer() *mdhtml.Renderer {
+// setHighlightOptions moves any highlighting options out of the info string of a fenced code block,
+// such as the "linenos=false" of ```{go linenos=false},
+// and into an attribute of the rendered <code> element.
+func setHighlightOptions(block *ast.CodeBlock) {
+	fields := strings.Fields(string(block.Info))
+	if len(fields) == 0 {
+		return
+	}
+	lang, opts := fields[0], fields[1:]
+	if strings.Contains(lang, "=") {
+		lang, opts = "", fields
+	}
+	block.Info = []byte(lang)
+	if len(opts) == 0 {
+		return
+	}
+	if block.Attribute == nil {
+		block.Attribute = &ast.Attribute{}
+	}
+	if block.Attribute.Attrs == nil {
+		block.Attribute.Attrs = map[string][]byte{}
+	}
+	block.Attribute.Attrs[highlightAttr] = []byte(html.EscapeString(strings.Join(opts, " ")))
+}
+
+// newRenderer returns an HTML renderer with the flags,
+// which gives each node to hooks in turn
+// before rendering it the default way.
+func newRenderer(flags mdhtml.Flags, hooks []mdhtml.RenderNodeFunc) *mdhtml.Renderer {
 	opts := mdhtml.RendererOptions{
-		Flags: mdhtml.FlagsNone,
+		Flags: flags,
+		RenderNodeHook: func(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+			for _, hook := range hooks {
+				if status, ok := hook(w, node, entering); ok {
+					return status, true
+				}
+			}
+			return ast.GoToNext, false
+		},
 	}
 	return mdhtml.NewRenderer(opts)
 }
 
+// smartypantsHook returns a render hook that writes text with smart punctuation,
+// as the renderer does with the Smartypants flag,
+// except for any Go template syntax in it,
+// whose quotes must stay straight for the template to parse.
+// Template syntax may span several text nodes,
+// so the hook remembers whether the last one left it inside an action.
+func smartypantsHook(flags mdhtml.Flags) mdhtml.RenderNodeFunc {
+	sp := mdhtml.NewSmartypantsRenderer(flags)
+	var inTemplate bool
+	return func(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+		text, ok := node.(*ast.Text)
+		if !ok {
+			return ast.GoToNext, false
+		}
+		lit := text.Literal
+		for len(lit) > 0 {
+			end := len(lit)
+			if inTemplate {
+				if i := bytes.Index(lit, templateEnd); i >= 0 {
+					end = i + len(templateEnd)
+					inTemplate = false
+				}
+				mdhtml.EscapeHTML(w, lit[:end])
+				lit = lit[end:]
+				continue
+			}
+			if i := bytes.Index(lit, templateStart); i >= 0 {
+				end = i
+				inTemplate = true
+			}
+			var tmp bytes.Buffer
+			mdhtml.EscapeHTML(&tmp, lit[:end])
+			sp.Process(w, tmp.Bytes())
+			lit = lit[end:]
+		}
+		return ast.GoToNext, true
+	}
+}
+
 func parserHook(data []byte) (ast.Node, []byte, int) {
 	if !bytes.HasPrefix(data, templateStart) {
 		return nil, nil, 0
@@ -3,10 +3,12 @@ package document // import "twos.dev/winter/document"
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/gomarkdown/markdown/ast"
 	"gotest.tools/v3/assert"
 )
 
@@ -49,6 +51,21 @@ func TestMarkdown(t *testing.T) {
 			input:    `![Alt text](/path/to/image.png)`,
 			expected: "<p><img src=\"/path/to/image.png\" alt=\"Alt text\" /></p>\n",
 		},
+		{
+			name:     "CodeBlockOptions",
+			input:    "```go {linenos=false hl_lines=[3,5-7]}\npackage main\n```",
+			expected: "<pre><code class=\"language-go\" data-highlight=\"linenos=false hl_lines=[3,5-7]\">package main\n</code></pre>\n",
+		},
+		{
+			name:     "CodeBlockOptionsWithoutLanguage",
+			input:    "```{start=10}\nhello\n```",
+			expected: "<pre><code data-highlight=\"start=10\">hello\n</code></pre>\n",
+		},
+		{
+			name:     "CodeBlockOptionsInsideCodeBlock",
+			input:    "````md\n```go {linenos=false}\n````",
+			expected: "<pre><code class=\"language-md\">```go {linenos=false}\n</code></pre>\n",
+		},
 	} {
 		t.Run(test.name, func(t *testing.T) {
 			src := fmt.Sprintf("src/test/%s", test.name)
@@ -64,3 +81,96 @@ func TestMarkdown(t *testing.T) {
 		})
 	}
 }
+
+func TestMarkdownGeminiDropsCodeBlockOptions(t *testing.T) {
+	src := "src/test/GeminiCodeBlockOptions"
+	doc := NewMarkdownDocument(src, NewMetadata(src, filepath.Join("testdata", "templates")), nil)
+	assert.NilError(t, doc.Load(strings.NewReader("```go {linenos=false}\npackage main\n```\n")))
+	var gemtext bytes.Buffer
+	assert.NilError(t, doc.RenderGemini(&gemtext))
+	assert.Equal(t, gemtext.String(), "```go\npackage main\n```\n")
+}
+
+func TestMarkdownExtensions(t *testing.T) {
+	RegisterMarkdownExtension("shout", MarkdownExtension{
+		RenderNode: func(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+			if text, ok := node.(*ast.Text); ok {
+				_, _ = w.Write(bytes.ToUpper(text.Literal))
+				return ast.GoToNext, true
+			}
+			return ast.GoToNext, false
+		},
+	})
+	t.Cleanup(func() {
+		markdownExtensionsMu.Lock()
+		defer markdownExtensionsMu.Unlock()
+		delete(markdownExtensions, "shout")
+	})
+
+	for _, test := range []struct {
+		name     string
+		cfg      map[string]bool
+		input    string
+		expected string
+	}{
+		{
+			name:     "DefinitionListsFromFrontmatter",
+			input:    "---\nmarkdown:\n  extensions:\n    definition_lists: true\n---\nKiln\n: A hot box.\n",
+			expected: "<dl>\n<dt>Kiln</dt>\n<dd>A hot box.</dd>\n</dl>\n",
+		},
+		{
+			name:     "TablesDisabledInConfig",
+			cfg:      map[string]bool{"tables": false},
+			input:    "| a |\n|---|\n| b |\n",
+			expected: "<p>| a |\n|---|\n| b |</p>\n",
+		},
+		{
+			name:     "FrontmatterOverridesConfig",
+			cfg:      map[string]bool{"hard_line_breaks": true},
+			input:    "---\nmarkdown:\n  extensions:\n    hard_line_breaks: false\n---\none\ntwo\n",
+			expected: "<p>one\ntwo</p>\n",
+		},
+		{
+			name:     "SmartypantsLeavesTemplatesAlone",
+			cfg:      map[string]bool{"smartypants": true},
+			input:    "\"Hot\" -- {{ template \"_x.html.tmpl\" }}\n",
+			expected: "<p>&ldquo;Hot&rdquo; &ndash; {{ template \"_x.html.tmpl\" }}</p>\n",
+		},
+		{
+			name:     "Admonition",
+			cfg:      map[string]bool{"admonitions": true},
+			input:    "> [!WARNING]\n> The kiln is *hot*.\n\nAfter.\n",
+			expected: "<blockquote>\n<p><strong>Warning:</strong></p>\n\n<p>The kiln is <em>hot</em>.</p>\n</blockquote>\n\n<p>After.</p>\n",
+		},
+		{
+			name:     "AdmonitionList",
+			cfg:      map[string]bool{"admonitions": true},
+			input:    "> [!TIP]\n> - Vent the room.\n> - Wear gloves.\n",
+			expected: "<blockquote>\n<p><strong>Tip:</strong></p>\n\n<ul>\n<li>Vent the room.</li>\n<li>Wear gloves.</li>\n</ul>\n</blockquote>\n",
+		},
+		{
+			name:     "RegisteredExtension",
+			input:    "---\nmarkdown:\n  extensions:\n    shout: true\n---\nhello\n",
+			expected: "<p>HELLO</p>\n",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			src := fmt.Sprintf("src/test/%s.md", test.name)
+			meta := NewMetadata(src, filepath.Join("testdata", "templates"))
+			s := &Substructure{cfg: &Config{}}
+			s.cfg.Markdown.Extensions = test.cfg
+			doc := NewMarkdownDocument(src, meta, map[Document]struct{}{
+				NewHTMLDocument(src, meta, s, nil): {},
+			})
+			assert.NilError(t, doc.Load(strings.NewReader(test.input)))
+			assert.Equal(t, string(doc.html), test.expected)
+		})
+	}
+}
+
+func TestMarkdownUnknownExtension(t *testing.T) {
+	src := "src/test/unknown.md"
+	doc := NewMarkdownDocument(src, NewMetadata(src, filepath.Join("testdata", "templates")), nil)
+	err := doc.Load(strings.NewReader("---\nmarkdown:\n  extensions:\n    sparkles: true\n---\nHi.\n"))
+	assert.ErrorContains(t, err, `unknown Markdown extension "sparkles"`)
+}
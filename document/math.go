@@ -0,0 +1,86 @@
+package document // import "twos.dev/winter/document"
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/wyatt915/treeblood"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// mathDelimiters are the pairs of delimiters that can surround the TeX inside a math span.
+var mathDelimiters = [][2]string{
+	{`\(`, `\)`},
+	{`\[`, `\]`},
+	{`$$`, `$$`},
+	{`$`, `$`},
+}
+
+// renderMath converts the TeX in every math span,
+// such as <span class="math inline">\(x^2\)</span>,
+// into MathML,
+// if configured to.
+// Otherwise the spans are left for a client-side library such as KaTeX.
+//
+// Markdown and Org both mark math up this way,
+// so it is rendered the same whichever format it was written in.
+func (doc *HTMLDocument) renderMath() error {
+	if doc.s == nil || doc.s.cfg == nil || !doc.s.cfg.Math.Render {
+		return nil
+	}
+	pitz := treeblood.NewDocument(doc.s.cfg.Math.Macros, false)
+	pitz.PrintOneLine = true
+	for _, span := range allOfTypes(doc.root, map[atom.Atom]struct{}{atom.Span: {}}) {
+		display, ok := mathKind(span)
+		if !ok {
+			continue
+		}
+		tex := stripMathDelimiters(text(span))
+		render := pitz.TextStyle
+		if display {
+			render = pitz.DisplayStyle
+		}
+		mathml, err := render(tex)
+		if err != nil {
+			return fmt.Errorf("cannot render math %q in %s: %w", tex, doc.meta.SourcePath, err)
+		}
+		nodes, err := html.ParseFragment(strings.NewReader(strings.TrimSpace(mathml)), span.Parent)
+		if err != nil {
+			return fmt.Errorf("cannot parse MathML for %q in %s: %w", tex, doc.meta.SourcePath, err)
+		}
+		for _, n := range nodes {
+			span.Parent.InsertBefore(n, span)
+		}
+		span.Parent.RemoveChild(span)
+	}
+	return nil
+}
+
+// mathKind reports whether n is a span of math,
+// and if so whether it is displayed on its own line rather than inline.
+func mathKind(n *html.Node) (display, ok bool) {
+	var isMath bool
+	for _, class := range strings.Fields(attr(n, atom.Class)) {
+		switch class {
+		case "math":
+			isMath = true
+		case "display":
+			display = true
+		}
+	}
+	return display, isMath
+}
+
+// stripMathDelimiters returns tex without the delimiters around it,
+// such as \( and \).
+// Environments such as \begin{align}…\end{align} are kept whole.
+func stripMathDelimiters(tex string) string {
+	tex = strings.TrimSpace(tex)
+	for _, d := range mathDelimiters {
+		if len(tex) >= len(d[0])+len(d[1]) && strings.HasPrefix(tex, d[0]) && strings.HasSuffix(tex, d[1]) {
+			return strings.TrimSpace(tex[len(d[0]) : len(tex)-len(d[1])])
+		}
+	}
+	return tex
+}
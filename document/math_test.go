@@ -0,0 +1,88 @@
+package document // import "twos.dev/winter/document"
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestRenderMath(t *testing.T) {
+	s := &Substructure{cfg: &Config{}}
+	s.cfg.Math.Render = true
+	s.cfg.Math.Macros = map[string]string{"R": `\mathbb{R}`}
+
+	for _, test := range []struct {
+		name   string
+		ext    string
+		input  string
+		want   []string
+		absent []string
+	}{
+		{
+			name:   "MarkdownInline",
+			ext:    ".md",
+			input:  `Let $x^2 < y$ hold.`,
+			want:   []string{`<math `, `display="inline"`, `<msup><mi>x</mi><mn>2</mn></msup>`},
+			absent: []string{`\(`, `class="math inline"`},
+		},
+		{
+			name:  "MarkdownDisplay",
+			ext:   ".md",
+			input: "$$\n\\frac{a}{b}\n$$",
+			want:  []string{`display="block"`, `<mfrac>`},
+		},
+		{
+			name:  "Macros",
+			ext:   ".md",
+			input: `Let $x \in \R$.`,
+			want:  []string{`ℝ`},
+		},
+		{
+			name:   "OrgInline",
+			ext:    ".org",
+			input:  `Let \(x^2\) and $y$ hold.`,
+			want:   []string{`<msup><mi>x</mi><mn>2</mn></msup>`, `<mi>y</mi>`},
+			absent: []string{`\(`, `$`},
+		},
+		{
+			name:  "OrgDisplay",
+			ext:   ".org",
+			input: "\\[\n\\frac{a}{b}\n\\]",
+			want:  []string{`display="block"`, `<mfrac>`},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			src := filepath.Join("src", "test", "math"+test.ext)
+			meta := NewMetadata(src, filepath.Join("testdata", "templates"))
+			htm := NewHTMLDocument(src, meta, s, nil)
+			var doc Document
+			if test.ext == ".org" {
+				doc = NewOrgDocument(src, meta, htm)
+			} else {
+				doc = NewMarkdownDocument(src, meta, map[Document]struct{}{htm: {}})
+			}
+			assert.NilError(t, doc.Load(strings.NewReader(test.input)))
+			var buf strings.Builder
+			assert.NilError(t, doc.Render(&buf))
+			for _, want := range test.want {
+				assert.Assert(t, strings.Contains(buf.String(), want), buf.String())
+			}
+			for _, absent := range test.absent {
+				assert.Assert(t, !strings.Contains(buf.String(), absent), buf.String())
+			}
+		})
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		src := filepath.Join("src", "test", "math.md")
+		meta := NewMetadata(src, filepath.Join("testdata", "templates"))
+		htm := NewHTMLDocument(src, meta, &Substructure{cfg: &Config{}}, nil)
+		doc := NewMarkdownDocument(src, meta, map[Document]struct{}{htm: {}})
+		assert.NilError(t, doc.Load(strings.NewReader(`Let $x^2$ hold.`)))
+		var buf strings.Builder
+		assert.NilError(t, doc.Render(&buf))
+		assert.Assert(t, strings.Contains(buf.String(), `<span class="math inline">\(x^2\)</span>`), buf.String())
+	})
+}
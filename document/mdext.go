@@ -0,0 +1,167 @@
+package document // import "twos.dev/winter/document"
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gomarkdown/markdown/ast"
+	mdhtml "github.com/gomarkdown/markdown/html"
+	"github.com/gomarkdown/markdown/parser"
+)
+
+// A MarkdownExtension is an optional part of Markdown syntax,
+// such as tables or definition lists.
+// Sites enable or disable extensions by name in winter.yml,
+// and documents in their frontmatter:
+//
+//	markdown:
+//	  extensions:
+//	    definition_lists: true
+//	    tables: false
+type MarkdownExtension struct {
+	// Default is whether the extension is enabled
+	// when neither winter.yml nor frontmatter says otherwise.
+	Default bool
+	// Parser holds the parser extensions the extension turns on.
+	Parser parser.Extensions
+	// Flags holds the HTML renderer flags the extension turns on.
+	Flags mdhtml.Flags
+	// ParseBlock optionally recognizes custom syntax at the start of a block of data.
+	// It returns the node the syntax becomes,
+	// any data to parse as the node's children,
+	// and the number of bytes of data it consumed,
+	// which is 0 if it does not recognize the data.
+	ParseBlock parser.BlockFunc
+	// RenderNode optionally renders nodes into HTML,
+	// such as the custom nodes ParseBlock returns.
+	// It returns false for any node it leaves to the default renderer.
+	RenderNode mdhtml.RenderNodeFunc
+}
+
+var (
+	markdownExtensionsMu sync.RWMutex
+	markdownExtensions   = map[string]MarkdownExtension{
+		"admonitions":      {ParseBlock: parseAdmonition},
+		"attributes":       {Default: true, Parser: parser.Attributes},
+		"autolink":         {Default: true, Parser: parser.Autolink},
+		"definition_lists": {Parser: parser.DefinitionLists},
+		"fenced_code":      {Default: true, Parser: parser.FencedCode},
+		"footnotes":        {Default: true, Parser: parser.Footnotes},
+		"hard_line_breaks": {Parser: parser.HardLineBreak},
+		"heading_ids":      {Default: true, Parser: parser.HeadingIDs},
+		"math":             {Default: true, Parser: parser.MathJax},
+		"smartypants": {
+			Flags: mdhtml.Smartypants |
+				mdhtml.SmartypantsFractions |
+				mdhtml.SmartypantsDashes |
+				mdhtml.SmartypantsLatexDashes,
+		},
+		"strikethrough": {Default: true, Parser: parser.Strikethrough},
+		"superscript":   {Parser: parser.SuperSubscript},
+		"tables":        {Default: true, Parser: parser.Tables},
+	}
+)
+
+// RegisterMarkdownExtension makes ext available to Markdown documents under name,
+// alongside the extensions Winter supports out of the box.
+// Call it before creating a [Substructure].
+//
+// Registering an extension under a name replaces any previously registered under it,
+// including the built-in ones.
+func RegisterMarkdownExtension(name string, ext MarkdownExtension) {
+	markdownExtensionsMu.Lock()
+	defer markdownExtensionsMu.Unlock()
+	markdownExtensions[name] = ext
+}
+
+// enabledMarkdownExtensions returns the Markdown extensions enabled for the document described by meta,
+// in order of name.
+// Frontmatter takes precedence over cfg,
+// which takes precedence over each extension's default.
+// cfg may be nil.
+//
+// Naming an extension that does not exist is an error.
+func enabledMarkdownExtensions(cfg *Config, meta *Metadata) ([]MarkdownExtension, error) {
+	markdownExtensionsMu.RLock()
+	defer markdownExtensionsMu.RUnlock()
+	var settings []map[string]bool
+	if cfg != nil {
+		settings = append(settings, cfg.Markdown.Extensions)
+	}
+	if meta != nil {
+		settings = append(settings, meta.Markdown.Extensions)
+	}
+	for _, setting := range settings {
+		for name := range setting {
+			if _, ok := markdownExtensions[name]; !ok {
+				return nil, fmt.Errorf("unknown Markdown extension %q", name)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(markdownExtensions))
+	for name := range markdownExtensions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var exts []MarkdownExtension
+	for _, name := range names {
+		enabled := markdownExtensions[name].Default
+		for _, setting := range settings {
+			if v, ok := setting[name]; ok {
+				enabled = v
+			}
+		}
+		if enabled {
+			exts = append(exts, markdownExtensions[name])
+		}
+	}
+	return exts, nil
+}
+
+// admonitionStart matches the first line of an admonition,
+// a blockquote that opens with its kind,
+// as in > [!NOTE].
+var admonitionStart = regexp.MustCompile(`^ {0,3}> ?\[!(NOTE|TIP|IMPORTANT|WARNING|CAUTION)\][ \t]*(\n|$)`)
+
+// parseAdmonition parses an admonition at the start of data,
+// a note, warning, or other aside from the main text
+// written as a blockquote that opens with its kind,
+// as on GitHub:
+//
+//	> [!WARNING]
+//	> The kiln is hot.
+//
+// The admonition becomes a blockquote that opens with a paragraph of its kind in bold,
+// as in **Warning:**,
+// which the HTML document turns into a callout.
+// The label is a paragraph of its own
+// so that a list, heading, or code block can start the body.
+func parseAdmonition(data []byte) (ast.Node, []byte, int) {
+	m := admonitionStart.FindSubmatchIndex(data)
+	if m == nil {
+		return nil, nil, 0
+	}
+	kind := strings.ToLower(string(data[m[2]:m[3]]))
+	var inner bytes.Buffer
+	fmt.Fprintf(&inner, "**%s:**\n\n", strings.ToUpper(kind[:1])+kind[1:])
+	consumed := m[1]
+	for consumed < len(data) {
+		line := data[consumed:]
+		if i := bytes.IndexByte(line, '\n'); i >= 0 {
+			line = line[:i+1]
+		}
+		quoted := bytes.TrimLeft(line, " ")
+		if !bytes.HasPrefix(quoted, []byte(">")) {
+			break
+		}
+		quoted = bytes.TrimPrefix(quoted[1:], []byte(" "))
+		inner.Write(quoted)
+		consumed += len(line)
+	}
+	return &ast.BlockQuote{}, inner.Bytes(), consumed
+}
@@ -5,6 +5,7 @@ import (
 	"html/template"
 	"io"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -22,6 +23,10 @@ var textDocExts = map[string]struct{}{
 
 // Metadata holds information about a Document that isn't inside the document itself.
 type Metadata struct {
+	// Backlinks are the documents that link to this one,
+	// most recent first.
+	// They are filled in by the substructure as documents are built.
+	Backlinks []Document `yaml:"-"`
 	// Category is an optional category for the document. This is used
 	// only for a small visual treatment on the index page (if this is
 	// of kind post) and on the document page itself.
@@ -32,7 +37,15 @@ type Metadata struct {
 	// code.
 	Category string `yaml:"category,omitempty"`
 	// CreatedAt is the time the document was first published.
+	//
+	// If CreatedAt is in the future,
+	// the document is scheduled:
+	// its page is built,
+	// but it is left out of listings and feeds until that time.
 	CreatedAt time.Time `yaml:"date,omitempty"`
+	// ExpiresAt is the time after which the document is left out of listings and feeds.
+	// Its page stays in place, because cool URIs don't change.
+	ExpiresAt time.Time `yaml:"expires,omitempty"`
 	// Kind specifies the type of document this is.
 	// In every user-facing context, this is called "type".
 	// In Go we cannot use the "type" keyword, so we use "kind" instead.
@@ -41,6 +54,9 @@ type Metadata struct {
 	//
 	// If unset, src/templates/text_document.html.tmpl is used.
 	Layout string `yaml:"layout,omitempty"`
+	// Markdown overrides the site's Markdown options for this document,
+	// such as to enable definition lists in one document only.
+	Markdown MarkdownOptions `yaml:"markdown,omitempty"`
 	// GeminiPath is the path component of the Geminispace URL that will point to this document,
 	// once rendered.
 	// GeminiPath MUST NOT contain any slashes;
@@ -48,25 +64,54 @@ type Metadata struct {
 	//
 	// GeminiPath is equivalent to the path to the destination file relative to dist.
 	GeminiPath string `yaml:"-,omitempty"`
+	// OutboundLinks are the documents this one links to,
+	// most recent first.
+	// They are filled in by the substructure as documents are built.
+	OutboundLinks []Document `yaml:"-"`
 	// ParentFilename is the filename component of another document that this one is a child of.
 	// Parenthood is a purely semantic relationship for the benefit of the user.
 	// Templates can access parents to influence rendering.
 	ParentFilename string `yaml:"parent,omitempty"`
 	// Preview is a sentence-long blurb of the document,
 	// to be shown along with its title as a teaser of its contents.
+	//
+	// If unset, it is the plain text of the document's Summary,
+	// shortened to a configurable length unless the document has a <!--more--> marker.
 	Preview string `yaml:"preview,omitempty"`
+	// Series is the name of the series this document is a part of, if any.
+	// Documents sharing a series are ordered by SeriesOrder,
+	// and can link to each other's previous and next parts.
+	Series string `yaml:"series,omitempty"`
+	// SeriesOrder is the 1-based position of this document in its series.
+	// It is required for every document in a series.
+	SeriesOrder int `yaml:"series_order,omitempty"`
+	// Stats are figures derived from the document's content,
+	// such as its word count and estimated reading time.
+	// They are filled in when the document is loaded.
+	Stats Stats `yaml:"-"`
 	// SourcePath is the location on disk of the original file that this document represents.
 	// It is relative to the working directory.
 	SourcePath string `yaml:"-"`
+	// Summary is the opening of the document as HTML,
+	// to be shown in place of the full document in listings.
+	// It is everything before the document's <!--more--> marker,
+	// or its first paragraph if it has none.
+	Summary template.HTML `yaml:"-"`
 	// TemplateDir is the location on disk of a directory containing any templates that will be used in the document.
 	// By default, it is src/templates.
 	TemplateDir string `yaml:"-"`
 	// Title is the human-readable title of the document.
 	Title string `yaml:"title,omitempty"`
 	// TOC is whether a table of contents should be rendered with the
-	// document. If true, the table of contents is rendered immediately
-	// above the first non-first-level heading.
-	TOC bool `yaml:"toc,omitempty"`
+	// document. If true, the table of contents is rendered in place of a
+	// <!-- toc --> marker, or else immediately above the first heading it
+	// lists, unless TOCOptions say it is manual.
+	TOC bool `yaml:"-"`
+	// TOCOptions describe the document's table of contents,
+	// including its entries once the document is loaded.
+	// They are set by the toc frontmatter,
+	// and TOC follows their Enabled.
+	TOCOptions TOCOptions `yaml:"toc,omitempty"`
 	// UpdatedAt is the time the document was last meaningfully updated.
 	UpdatedAt time.Time `yaml:"updated,omitempty"`
 	// WebPath is the path component of the URL that will point to this document,
@@ -77,6 +122,14 @@ type Metadata struct {
 	// WebPath is equivalent to the path to the destination file
 	// relative to dist.
 	WebPath string `yaml:"filename,omitempty"`
+
+	// feed is set while the document is rendered for a feed.
+	feed bool
+	// links is the set of web paths of documents this one links to,
+	// as written in its source.
+	// It is nil for documents that are not HTML,
+	// such as static files.
+	links map[string]struct{}
 }
 
 // NewMetadata returns a Metadata with some defaults filled in
@@ -90,6 +143,11 @@ type Metadata struct {
 // are not filled in.
 func NewMetadata(src, tmplDir string) *Metadata {
 	filename := filepath.Base(src)
+	if _, name, ok := strings.Cut(src, subdocumentSep); ok {
+		// The document is one of several in its file,
+		// so it is named by its name within the file.
+		filename = name
+	}
 	i := strings.IndexRune(filename, '.')
 	if i < 0 {
 		i = len(filename)
@@ -97,7 +155,7 @@ func NewMetadata(src, tmplDir string) *Metadata {
 	noExt := filename[0:i]
 	webPath := noExt
 	geminiPath := "" // Can't have Gemini files overwriting extensionless "web" files like CNAME
-	if _, ok := textDocExts[filepath.Ext(src)]; ok {
+	if isTextDocExt(filepath.Ext(sourceFile(src))) {
 		webPath = fmt.Sprintf("%s.html", noExt)
 		geminiPath = fmt.Sprintf("%s.gmi", noExt)
 	}
@@ -111,6 +169,42 @@ func NewMetadata(src, tmplDir string) *Metadata {
 	}
 }
 
+// setAttribute sets the field of meta that key names to value,
+// for formats that declare metadata in their own header syntax instead of frontmatter,
+// such as Org's #+DATE: or AsciiDoc's :date:.
+// Keys are the same as those of frontmatter,
+// in any case.
+// Unknown keys are ignored.
+func (meta *Metadata) setAttribute(key, value string) error {
+	var err error
+	switch strings.ToLower(key) {
+	case "category":
+		meta.Category = value
+	case "date":
+		meta.CreatedAt, err = time.Parse("2006-01-02", value)
+	case "expires":
+		meta.ExpiresAt, err = time.Parse("2006-01-02", value)
+	case "type":
+		meta.Kind, err = parseKind(value)
+	case "filename":
+		meta.WebPath = value
+	case "series":
+		meta.Series = value
+	case "series_order":
+		meta.SeriesOrder, err = strconv.Atoi(value)
+	case "title":
+		meta.Title = value
+	case "toc":
+		meta.TOCOptions = TOCOptions{Enabled: value == "t" || value == "true"}
+		if depth, err := strconv.Atoi(value); err == nil {
+			meta.TOCOptions = TOCOptions{Enabled: true, Max: depth}
+		}
+	case "updated":
+		meta.UpdatedAt, err = time.Parse("2006-01-02", value)
+	}
+	return err
+}
+
 func (meta *Metadata) IsType(t string) bool {
 	k, err := parseKind(t)
 	if err != nil {
@@ -119,6 +213,20 @@ func (meta *Metadata) IsType(t string) bool {
 	return k == meta.Kind
 }
 
+// ListedAt returns whether the document should appear in listings and feeds at time t.
+//
+// Documents dated after t are not listed unless future is true.
+// Documents that expire at or before t are never listed.
+func (meta *Metadata) ListedAt(t time.Time, future bool) bool {
+	if !future && meta.CreatedAt.After(t) {
+		return false
+	}
+	if !meta.ExpiresAt.IsZero() && !meta.ExpiresAt.After(t) {
+		return false
+	}
+	return true
+}
+
 // UnmarshalDocument parses the metadata from the given reader,
 // then reads and returns the remaining bytes.
 func (meta *Metadata) UnmarshalDocument(r io.Reader) ([]byte, error) {
@@ -128,21 +236,3 @@ func (meta *Metadata) UnmarshalDocument(r io.Reader) ([]byte, error) {
 	}
 	return b, nil
 }
-
-// funcmap returns a [template.FuncMap] for the document.
-// It can be used with [html/template.Template.Funcs].
-func (meta *Metadata) funcmap() template.FuncMap {
-	now := time.Now()
-
-	return template.FuncMap{
-		"add": add,
-		"div": div,
-		"mul": mul,
-		"sub": sub,
-
-		"now": func() time.Time { return now },
-
-		"render": render,
-		"yearly": yearly,
-	}
-}
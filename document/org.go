@@ -1,27 +1,50 @@
 package document // import "twos.dev/winter/document"
 
 import (
+	"bytes"
+	"fmt"
+	"html"
 	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
 	"strings"
-	"time"
+	"unicode/utf8"
 
 	"github.com/niklasfasching/go-org/org"
 )
 
+var (
+	// orgInclude matches an #+INCLUDE: keyword that includes another Org file as is,
+	// rather than as a source, example, or export block.
+	orgInclude = regexp.MustCompile(`(?im)^[ \t]*#\+INCLUDE:[ \t]*"([^"]+)"[ \t]*$`)
+	// orgTimestamp matches an Org timestamp,
+	// such as <2024-01-02 Tue> or [2024-01-02 Tue 10:00].
+	orgTimestamp = regexp.MustCompile(`^[<\[](\d{4}-\d{2}-\d{2})[^>\]]*[>\]]$`)
+)
+
 // OrgDocument represents a source file written in Org,
+// or a subtree of one,
 // with optional Go template syntax embedded in it.
 //
-// OrgDocument implements [Document].
+// OrgDocument implements [Document] and [GeminiRenderer].
 //
 // The OrgDocument is transitory;
-// its only purpose is to create an [HTMLDocument].
+// its only purposes are to create an [HTMLDocument]
+// and to convert itself into gemtext.
 type OrgDocument struct {
 	// SourcePath is the path on disk to the file this Org is read from or generated from.
 	// The path is relative to the working directory.
+	//
+	// For a subtree exported as a document of its own,
+	// SourcePath is the path to the file followed by :: and the subtree's :EXPORT_FILE_NAME:,
+	// as in src/cold/notes.org::kiln.
 	SourcePath string
 
-	deps map[string]struct{}
-	meta *Metadata
+	deps    map[string]struct{}
+	meta    *Metadata
+	gemtext []byte
 	// next is the HTML document generated from this Org document.
 	next Document
 }
@@ -35,6 +58,7 @@ func NewOrgDocument(src string, meta *Metadata, next Document) *OrgDocument {
 		SourcePath: src,
 
 		deps: map[string]struct{}{
+			sourceFile(src):    {},
 			"public/style.css": {},
 		},
 		meta: meta,
@@ -51,11 +75,41 @@ func (doc *OrgDocument) DependsOn(src string) bool {
 
 // Load reads Org from r and loads it into doc.
 //
+// Keywords such as #+DATE:,
+// and properties in a property drawer at the top of the file,
+// set metadata.
+// A subtree exported as a document of its own is loaded alone,
+// with its headline as its title and its properties setting its metadata.
+// Subtrees tagged :noexport: are left out.
+//
 // If called more than once, the last call wins.
 func (d *OrgDocument) Load(r io.Reader) error {
+	file := sourceFile(d.SourcePath)
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("cannot read Org in %s: %w", d.SourcePath, err)
+	}
+	src, err = d.expandIncludes(file, src, map[string]struct{}{filepath.Clean(file): {}})
+	if err != nil {
+		return err
+	}
+
+	var includeErr error
 	orgparser := org.New()
 	orgparser.DefaultSettings["OPTIONS"] = strings.Replace(orgparser.DefaultSettings["OPTIONS"], "toc:t", "toc:nil", 1)
-	orgdoc := orgparser.Parse(r, d.SourcePath)
+	// go-org reads files included as source, example, or export blocks itself.
+	orgparser.ReadFile = func(name string) ([]byte, error) {
+		d.deps[filepath.Clean(name)] = struct{}{}
+		b, err := os.ReadFile(name)
+		if err != nil && includeErr == nil {
+			includeErr = err
+		}
+		return b, err
+	}
+	orgdoc := orgparser.Silent().Parse(bytes.NewReader(src), file)
+	if orgdoc.Error != nil {
+		return fmt.Errorf("cannot parse Org in %s: %w", d.SourcePath, orgdoc.Error)
+	}
 	orgdoc.BufferSettings["OPTIONS"] = strings.Replace(
 		orgdoc.BufferSettings["OPTIONS"],
 		"toc:t",
@@ -65,45 +119,219 @@ func (d *OrgDocument) Load(r io.Reader) error {
 
 	orgwriter := org.NewHTMLWriter()
 	orgwriter.TopLevelHLevel = 1
+	orgwriter.ExtendingWriter = &orgHTMLWriter{orgwriter}
+	orgwriter.HighlightCodeBlock = highlightOrgCodeBlock
 
-	var err error
+	_, subtree, isSubtree := strings.Cut(d.SourcePath, subdocumentSep)
 	for k, v := range orgdoc.BufferSettings {
-		switch strings.ToLower(k) {
-		case "category":
-			d.meta.Category = v
-		case "date":
-			d.meta.CreatedAt, err = time.Parse("2006-01-02", v)
-			if err != nil {
+		if err := d.setAttribute(k, v, isSubtree); err != nil {
+			return err
+		}
+	}
+	if len(orgdoc.Nodes) > 0 {
+		if drawer, ok := orgdoc.Nodes[0].(org.PropertyDrawer); ok {
+			if err := d.setProperties(drawer, isSubtree); err != nil {
 				return err
 			}
-		case "type":
-			var err error
-			d.meta.Kind, err = parseKind(v)
-			if err != nil {
+		}
+	}
+
+	var h *org.Headline
+	if isSubtree {
+		if h = exportedSubtree(orgdoc, subtree); h == nil {
+			return fmt.Errorf("cannot find subtree with :EXPORT_FILE_NAME: %s in %s", subtree, file)
+		}
+		if h.Properties != nil {
+			if err := d.setProperties(*h.Properties, false); err != nil {
 				return err
 			}
-		case "filename":
-			d.meta.WebPath = v
-		case "title":
-			d.meta.Title = v
-		case "toc":
-			d.meta.TOC = (v == "t" || v == "true")
-		case "updated":
-			d.meta.UpdatedAt, err = time.Parse("2006-01-02", v)
-			if err != nil {
-				return err
+		}
+		// The subtree's headline is the title,
+		// so its children are the body and its subheadings start at level 2.
+		delete(orgdoc.BufferSettings, "TITLE")
+		orgdoc.Nodes = h.Children
+		orgwriter.TopLevelHLevel = 2 - h.Lvl
+	}
+
+	gemwriter := &orgGemtextWriter{doc: orgdoc, src: d.SourcePath, topLevel: orgwriter.TopLevelHLevel}
+	if htmlDoc, ok := d.next.(*HTMLDocument); ok {
+		gemwriter.s = htmlDoc.s
+	}
+	switch {
+	case h != nil && d.meta.Title != "":
+		gemwriter.writeHeading(1, []org.Node{org.Text{Content: d.meta.Title}})
+	case h != nil:
+		gemwriter.writeHeading(1, h.Title)
+	case orgdoc.Get("TITLE") != "" && orgdoc.GetOption("title") != "nil":
+		title := orgdoc.Parse(strings.NewReader(orgdoc.Get("TITLE")), file)
+		if len(title.Nodes) == 1 {
+			if p, ok := title.Nodes[0].(org.Paragraph); ok {
+				title.Nodes = p.Children
 			}
 		}
+		gemwriter.writeHeading(1, title.Nodes)
 	}
+	gemwriter.writeNodes(orgdoc.Nodes)
+	d.gemtext = gemwriter.gemtext()
 
 	htm, err := orgdoc.Write(orgwriter)
 	if err != nil {
 		return err
 	}
+	if includeErr != nil {
+		return fmt.Errorf("cannot include file in %s: %w", d.SourcePath, includeErr)
+	}
+	if h != nil {
+		title := html.EscapeString(d.meta.Title)
+		if title == "" {
+			title = orgwriter.WriteNodesAsString(h.Title...)
+		}
+		htm = fmt.Sprintf("<h1>%s</h1>\n%s", title, htm)
+	}
 
 	return d.next.Load(strings.NewReader(htm))
 }
 
+// setProperties sets the metadata named by the properties in drawer.
+// If inherited is true,
+// the properties are those of the whole file being inherited by one of its subtrees.
+func (d *OrgDocument) setProperties(drawer org.PropertyDrawer, inherited bool) error {
+	for _, kv := range drawer.Properties {
+		if err := d.setAttribute(kv[0], kv[1], inherited); err != nil {
+			return fmt.Errorf("cannot read property :%s: in %s: %w", kv[0], d.SourcePath, err)
+		}
+	}
+	return nil
+}
+
+// setAttribute sets the metadata named by the Org keyword or property key to value.
+// Keys are optionally prefixed with EXPORT_,
+// as in :EXPORT_DATE: or :DATE:.
+// If inherited is true,
+// the key is one of the whole file being inherited by one of its subtrees,
+// so keys that name the file itself,
+// such as its title,
+// are ignored.
+func (d *OrgDocument) setAttribute(key, value string, inherited bool) error {
+	key = strings.TrimPrefix(strings.ToLower(key), "export_")
+	if inherited && (key == "title" || key == "filename") {
+		return nil
+	}
+	return d.meta.setAttribute(key, orgValue(value))
+}
+
+// expandIncludes replaces each line of src,
+// the contents of the Org file at path,
+// that includes another Org file as is
+// with the contents of that file,
+// recursively.
+// seen holds the files already being included,
+// to catch files that include themselves.
+func (d *OrgDocument) expandIncludes(path string, src []byte, seen map[string]struct{}) ([]byte, error) {
+	var out bytes.Buffer
+	last := 0
+	for _, m := range orgInclude.FindAllSubmatchIndex(src, -1) {
+		out.Write(src[last:m[0]])
+		last = m[1]
+		included := string(src[m[2]:m[3]])
+		if !filepath.IsAbs(included) {
+			included = filepath.Join(filepath.Dir(path), included)
+		}
+		included = filepath.Clean(included)
+		if _, ok := seen[included]; ok {
+			return nil, fmt.Errorf("cannot include %s in %s: it includes itself", included, path)
+		}
+		d.deps[included] = struct{}{}
+		b, err := os.ReadFile(included)
+		if err != nil {
+			return nil, fmt.Errorf("cannot include %s in %s: %w", included, path, err)
+		}
+		seen[included] = struct{}{}
+		b, err = d.expandIncludes(included, b, seen)
+		delete(seen, included)
+		if err != nil {
+			return nil, err
+		}
+		out.Write(bytes.TrimRight(b, "\n"))
+	}
+	out.Write(src[last:])
+	return out.Bytes(), nil
+}
+
+// splitOrg returns the source paths of the subtrees of the Org file at src
+// that are exported as documents of their own
+// because they have an :EXPORT_FILE_NAME: property,
+// or nothing if the whole file is one document.
+func splitOrg(src string) ([]string, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read Org in %s: %w", src, err)
+	}
+	defer f.Close()
+	orgdoc := org.New().Silent().Parse(f, src)
+	if orgdoc.Error != nil {
+		return nil, fmt.Errorf("cannot parse Org in %s: %w", src, orgdoc.Error)
+	}
+	var srcs []string
+	walkExportedSubtrees(orgdoc, orgdoc.Outline.Section, func(name string, _ *org.Headline) bool {
+		srcs = append(srcs, src+subdocumentSep+name)
+		return true
+	})
+	return srcs, nil
+}
+
+// exportedSubtree returns the headline of the subtree of orgdoc whose :EXPORT_FILE_NAME: is name,
+// or nil if there is none.
+func exportedSubtree(orgdoc *org.Document, name string) (h *org.Headline) {
+	walkExportedSubtrees(orgdoc, orgdoc.Outline.Section, func(n string, headline *org.Headline) bool {
+		if n == name {
+			h = headline
+			return false
+		}
+		return true
+	})
+	return h
+}
+
+// walkExportedSubtrees calls fn with the :EXPORT_FILE_NAME: and headline of each subtree in section
+// that has one,
+// skipping subtrees excluded from export by their tags,
+// until fn returns false.
+func walkExportedSubtrees(orgdoc *org.Document, section *org.Section, fn func(name string, h *org.Headline) bool) bool {
+	if h := section.Headline; h != nil {
+		if h.IsExcluded(orgdoc) {
+			return true
+		}
+		if name, ok := h.Properties.Get("EXPORT_FILE_NAME"); ok && name != "" {
+			if !fn(name, h) {
+				return false
+			}
+		}
+	}
+	for _, child := range section.Children {
+		if !walkExportedSubtrees(orgdoc, child, fn) {
+			return false
+		}
+	}
+	return true
+}
+
+// orgValue returns the value of an Org keyword or property as metadata expects it,
+// turning timestamps such as <2024-01-02 Tue> into dates such as 2024-01-02.
+func orgValue(v string) string {
+	return orgTimestamp.ReplaceAllString(strings.TrimSpace(v), "$1")
+}
+
+// highlightOrgCodeBlock writes the source of an Org source block
+// as a code block like those of Markdown,
+// so it is highlighted or rendered the same way.
+func highlightOrgCodeBlock(source, lang string, inline bool, params map[string]string) string {
+	if inline {
+		return fmt.Sprintf("<code class=\"language-%s\">%s</code>", html.EscapeString(lang), html.EscapeString(source))
+	}
+	return fmt.Sprintf("<pre><code class=\"language-%s\">%s</code></pre>", html.EscapeString(lang), html.EscapeString(source))
+}
+
 func (doc *OrgDocument) Metadata() *Metadata {
 	return doc.meta
 }
@@ -111,3 +339,405 @@ func (doc *OrgDocument) Metadata() *Metadata {
 func (doc *OrgDocument) Render(w io.Writer) error {
 	return doc.next.Render(w)
 }
+
+func (doc *OrgDocument) RenderGemini(w io.Writer) error {
+	if _, err := w.Write(doc.gemtext); err != nil {
+		return fmt.Errorf("cannot render Org as gemtext: %w", err)
+	}
+	return nil
+}
+
+// orgHTMLWriter is an Org HTML writer that leaves links to source files as they are,
+// instead of guessing at the web page they will become.
+// The HTML document later resolves them to the real web paths of their targets.
+//
+// It also marks up LaTeX the way Markdown does,
+// so math is rendered the same whichever format it was written in.
+type orgHTMLWriter struct {
+	*org.HTMLWriter
+}
+
+// WriteRegularLink writes a link to a source file, such as [[file:other.org][text]],
+// as a link to that source file,
+// and any other link as go-org would.
+//
+// Org parses a [[toc]] marker as a link,
+// so it is written back as the marker for the HTML document to find.
+func (w *orgHTMLWriter) WriteRegularLink(l org.RegularLink) {
+	if isOrgTOCMarker(l) {
+		w.WriteString(tocTextMarker)
+		return
+	}
+	target, ok := orgFileLink(l)
+	file, _, _ := strings.Cut(target, subdocumentSep)
+	if !ok || l.Kind() != "regular" || !isTextDocExt(path.Ext(file)) {
+		w.HTMLWriter.WriteRegularLink(l)
+		return
+	}
+	href := html.EscapeString(target)
+	description := html.EscapeString(file)
+	if l.Description != nil {
+		description = w.WriteNodesAsString(l.Description...)
+	}
+	w.WriteString(fmt.Sprintf(`<a href="%s">%s</a>`, href, description))
+}
+
+// WriteLatexFragment writes inline LaTeX, such as \(x^2\) or $x^2$,
+// as a math span.
+// Display math, such as \[x^2\] or an environment, is marked as such.
+func (w *orgHTMLWriter) WriteLatexFragment(l org.LatexFragment) {
+	class, opening, closing := "math display", l.OpeningPair, l.ClosingPair
+	switch l.OpeningPair {
+	case `\(`, "$":
+		class, opening, closing = "math inline", `\(`, `\)`
+	case `\[`, "$$":
+		opening, closing = `\[`, `\]`
+	}
+	w.WriteString(fmt.Sprintf(`<span class="%s">%s`, class, opening))
+	org.WriteNodes(w, l.Content...)
+	w.WriteString(closing + "</span>")
+}
+
+// WriteLatexBlock writes a LaTeX environment on lines of its own,
+// such as \begin{align}…\end{align},
+// as a paragraph of display math.
+func (w *orgHTMLWriter) WriteLatexBlock(b org.LatexBlock) {
+	w.WriteString(`<p><span class="math display">`)
+	org.WriteNodes(w, b.Content...)
+	w.WriteString("</span></p>\n")
+}
+
+// orgGemtextWriter converts Org into gemtext.
+//
+// Gemtext has no inline markup,
+// so emphasis is dropped
+// and the links of a paragraph, list, or table are collected
+// and written on lines of their own after it.
+type orgGemtextWriter struct {
+	doc *org.Document
+	// s is the substructure links to source files are resolved in,
+	// if any.
+	s *Substructure
+	// src is the source path of the document being written,
+	// which relative links are relative to.
+	src string
+	// topLevel is the heading level of top-level headlines,
+	// as in [org.HTMLWriter.TopLevelHLevel].
+	topLevel int
+
+	b     strings.Builder
+	links []string
+}
+
+// gemtext returns the gemtext written so far.
+func (w *orgGemtextWriter) gemtext() []byte {
+	return []byte(strings.TrimRight(w.b.String(), "\n") + "\n")
+}
+
+// writeNodes writes the block-level Org nodes as gemtext,
+// each followed by a blank line.
+func (w *orgGemtextWriter) writeNodes(nodes []org.Node) {
+	for _, node := range nodes {
+		switch n := node.(type) {
+		case org.Headline:
+			if n.IsExcluded(w.doc) {
+				continue
+			}
+			w.writeHeading(n.Lvl-1+w.topLevel, n.Title)
+			w.writeNodes(n.Children)
+		case org.Paragraph:
+			if text := strings.TrimSpace(w.inline(n.Children)); text != "" {
+				w.b.WriteString(text + "\n\n")
+			}
+			w.flushLinks()
+		case org.List:
+			w.writeList(n)
+			w.b.WriteString("\n")
+			w.flushLinks()
+		case org.Block:
+			w.writeBlock(n)
+		case org.Example:
+			lines := make([]string, 0, len(n.Children))
+			for _, child := range n.Children {
+				lines = append(lines, w.inline([]org.Node{child}))
+			}
+			w.writePreformatted("", strings.Join(lines, "\n"))
+		case org.LatexBlock:
+			w.writePreformatted("latex", orgRawText(n.Content))
+		case org.Table:
+			w.writeTable(n)
+			w.flushLinks()
+		case org.FootnoteDefinition:
+			var text []string
+			for _, child := range n.Children {
+				if p, ok := child.(org.Paragraph); ok {
+					text = append(text, strings.TrimSpace(w.inline(p.Children)))
+				}
+			}
+			w.b.WriteString(fmt.Sprintf("[%s] %s\n\n", n.Name, strings.Join(text, " ")))
+			w.flushLinks()
+		case org.Result:
+			w.writeNodes([]org.Node{n.Node})
+		case org.NodeWithMeta:
+			w.writeNodes([]org.Node{n.Node})
+		case org.NodeWithName:
+			w.writeNodes([]org.Node{n.Node})
+		case org.Include:
+			w.writeNodes([]org.Node{n.Resolve()})
+		}
+	}
+}
+
+// writeHeading writes an Org headline title as a gemtext heading at level,
+// which is clamped to the three levels gemtext has.
+func (w *orgGemtextWriter) writeHeading(level int, title []org.Node) {
+	level = min(max(level, 1), 3)
+	w.b.WriteString(strings.Repeat("#", level) + " " + strings.TrimSpace(w.inline(title)) + "\n\n")
+	w.flushLinks()
+}
+
+// writeList writes each item of l as a gemtext list item.
+// Gemtext lists cannot be nested,
+// so the items of nested lists follow their parents.
+func (w *orgGemtextWriter) writeList(l org.List) {
+	for _, item := range l.Items {
+		switch item := item.(type) {
+		case org.ListItem:
+			var text []string
+			if l.Kind == "ordered" {
+				text = append(text, item.Bullet)
+			}
+			var sublists []org.List
+			for _, child := range item.Children {
+				switch child := child.(type) {
+				case org.Paragraph:
+					text = append(text, strings.TrimSpace(w.inline(child.Children)))
+				case org.List:
+					sublists = append(sublists, child)
+				}
+			}
+			w.b.WriteString(strings.TrimSpace("* "+strings.Join(text, " ")) + "\n")
+			for _, sublist := range sublists {
+				w.writeList(sublist)
+			}
+		case org.DescriptiveListItem:
+			var details []string
+			for _, child := range item.Details {
+				if p, ok := child.(org.Paragraph); ok {
+					details = append(details, strings.TrimSpace(w.inline(p.Children)))
+				}
+			}
+			w.b.WriteString(fmt.Sprintf("* %s: %s\n", strings.TrimSpace(w.inline(item.Term)), strings.Join(details, " ")))
+		}
+	}
+}
+
+// writeBlock writes an Org block such as #+BEGIN_SRC or #+BEGIN_QUOTE.
+// Source and example blocks become preformatted text;
+// quotes become quote lines.
+// Export blocks are for other formats,
+// so they are left out.
+func (w *orgGemtextWriter) writeBlock(b org.Block) {
+	params := b.ParameterMap()
+	switch b.Name {
+	case "SRC":
+		if params[":exports"] != "results" && params[":exports"] != "none" {
+			lang := ""
+			if len(b.Parameters) > 0 {
+				lang = strings.ToLower(b.Parameters[0])
+			}
+			w.writePreformatted(lang, orgRawText(b.Children))
+		}
+	case "EXAMPLE":
+		w.writePreformatted("", orgRawText(b.Children))
+	case "EXPORT":
+	case "QUOTE":
+		quote := &orgGemtextWriter{doc: w.doc, s: w.s, src: w.src, topLevel: w.topLevel}
+		quote.writeNodes(b.Children)
+		for _, line := range strings.Split(strings.TrimSpace(quote.b.String()), "\n") {
+			if line != "" && !strings.HasPrefix(line, "=>") {
+				line = "> " + line
+			}
+			w.b.WriteString(line + "\n")
+		}
+		w.b.WriteString("\n")
+	default:
+		w.writeNodes(b.Children)
+	}
+	if b.Result != nil && params[":exports"] != "code" && params[":exports"] != "none" {
+		w.writeNodes([]org.Node{b.Result})
+	}
+}
+
+// writeTable writes t as preformatted text with its columns aligned.
+func (w *orgGemtextWriter) writeTable(t org.Table) {
+	var rows [][]string
+	var widths []int
+	for _, row := range t.Rows {
+		if row.IsSpecial {
+			continue
+		}
+		cells := make([]string, len(row.Columns))
+		for i, col := range row.Columns {
+			cells[i] = strings.TrimSpace(w.inline(col.Children))
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[i] = max(widths[i], utf8.RuneCountInString(cells[i]))
+		}
+		rows = append(rows, cells)
+	}
+	lines := make([]string, len(rows))
+	for i, cells := range rows {
+		for j, cell := range cells {
+			cells[j] = cell + strings.Repeat(" ", widths[j]-utf8.RuneCountInString(cell))
+		}
+		lines[i] = strings.TrimRight(strings.Join(cells, " | "), " ")
+	}
+	w.writePreformatted("", strings.Join(lines, "\n"))
+}
+
+// writePreformatted writes text as a preformatted block,
+// with alt as its alt text.
+func (w *orgGemtextWriter) writePreformatted(alt, text string) {
+	w.b.WriteString("```" + alt + "\n" + strings.TrimRight(text, "\n") + "\n```\n\n")
+}
+
+// flushLinks writes the links collected since the last call,
+// one per line.
+func (w *orgGemtextWriter) flushLinks() {
+	if len(w.links) == 0 {
+		return
+	}
+	for _, link := range w.links {
+		w.b.WriteString(link + "\n")
+	}
+	w.b.WriteString("\n")
+	w.links = nil
+}
+
+// inline returns the text of the inline Org nodes,
+// collecting their links to be written later by flushLinks.
+func (w *orgGemtextWriter) inline(nodes []org.Node) string {
+	var b strings.Builder
+	for _, node := range nodes {
+		switch n := node.(type) {
+		case org.Text:
+			b.WriteString(n.Content)
+		case org.LineBreak, org.ExplicitLineBreak:
+			b.WriteString(" ")
+		case org.Emphasis:
+			b.WriteString(w.inline(n.Content))
+		case org.InlineBlock:
+			b.WriteString(w.inline(n.Children))
+		case org.LatexFragment:
+			b.WriteString(n.OpeningPair + w.inline(n.Content) + n.ClosingPair)
+		case org.StatisticToken:
+			b.WriteString("[" + n.Content + "]")
+		case org.FootnoteLink:
+			b.WriteString("[" + n.Name + "]")
+		case org.Timestamp:
+			if n.IsDate {
+				b.WriteString(n.Time.Format("2006-01-02"))
+			} else {
+				b.WriteString(n.Time.Format("2006-01-02 15:04"))
+			}
+		case org.RegularLink:
+			if isOrgTOCMarker(n) {
+				continue
+			}
+			description := strings.TrimSpace(w.inline(n.Description))
+			target, ok := w.linkTarget(n)
+			if n.Kind() == "regular" {
+				if description == "" {
+					description = n.URL
+				}
+				b.WriteString(description)
+			}
+			if ok && description != target {
+				w.links = append(w.links, strings.TrimSpace("=> "+target+" "+description))
+			} else if ok {
+				w.links = append(w.links, "=> "+target)
+			}
+		}
+	}
+	return b.String()
+}
+
+// orgRawText returns the text of the Org nodes as written,
+// keeping their line breaks,
+// for blocks whose contents are not Org markup,
+// such as source blocks.
+func orgRawText(nodes []org.Node) string {
+	var b strings.Builder
+	for _, node := range nodes {
+		switch n := node.(type) {
+		case org.Text:
+			b.WriteString(n.Content)
+		case org.LineBreak:
+			b.WriteString(strings.Repeat("\n", n.Count))
+		default:
+			b.WriteString(org.String([]org.Node{n}))
+		}
+	}
+	return b.String()
+}
+
+// isOrgTOCMarker reports whether l is a [[toc]] marker,
+// which marks where a table of contents goes rather than linking anywhere.
+func isOrgTOCMarker(l org.RegularLink) bool {
+	return l.Protocol == "" && l.URL == tocMarker && l.Description == nil
+}
+
+// orgFileLink returns the target of l without any file: prefix,
+// or false if l is not a link to a file.
+//
+// Org takes anything before a colon as the protocol of a link,
+// so a link like [[notes.org::kiln]] is a file link
+// even though it seems to have the protocol notes.org.
+func orgFileLink(l org.RegularLink) (string, bool) {
+	target := strings.TrimPrefix(l.URL, "file:")
+	if l.Protocol == "file" || l.Protocol == "" {
+		return target, true
+	}
+	file, _, ok := strings.Cut(target, subdocumentSep)
+	return target, ok && !strings.Contains(file, ":")
+}
+
+// linkTarget returns the URL a gemtext link to the target of l should point to,
+// or false if the target is not a page of its own,
+// such as a heading in the same document.
+//
+// Links to source files point to the gemtext pages built from them,
+// found through the substructure as links in HTML are,
+// so a link to a file split into several documents goes to its first document
+// unless it names another after ::.
+// Without a substructure,
+// the page is assumed to be named after the file.
+func (w *orgGemtextWriter) linkTarget(l org.RegularLink) (string, bool) {
+	link, ok := orgFileLink(l)
+	if !ok {
+		return l.URL, true
+	}
+	target, _, _ := strings.Cut(link, subdocumentSep)
+	if target == "" || strings.HasPrefix(target, "#") || strings.HasPrefix(target, "*") {
+		return "", false
+	}
+	src, _, ok := sourceLinkPath(link)
+	if !ok {
+		return target, true
+	}
+	if w.s != nil {
+		if doc, ok := w.s.docBySourceLink(w.src, src); ok {
+			if doc.Metadata().GeminiPath == "" {
+				return "", false
+			}
+			return "/" + strings.TrimPrefix(doc.Metadata().GeminiPath, "/"), true
+		}
+	}
+	name := path.Base(filepath.ToSlash(sourceFile(src)))
+	if i := strings.IndexRune(name, '.'); i >= 0 {
+		name = name[:i]
+	}
+	return "/" + name + ".gmi", true
+}
@@ -0,0 +1,318 @@
+package document // import "twos.dev/winter/document"
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/niklasfasching/go-org/org"
+	"gotest.tools/v3/assert"
+)
+
+// loadOrg loads the Org file at src into a document that renders it without a template,
+// and returns the document and its rendered HTML.
+func loadOrg(t *testing.T, src string) (*OrgDocument, string) {
+	t.Helper()
+	meta := NewMetadata(src, filepath.Join("testdata", "templates"))
+	doc := NewOrgDocument(src, meta, NewHTMLDocument(src, meta, nil, nil))
+	f, err := os.Open(sourceFile(src))
+	assert.NilError(t, err)
+	defer f.Close()
+	assert.NilError(t, doc.Load(f))
+	var buf strings.Builder
+	assert.NilError(t, doc.Render(&buf))
+	return doc, buf.String()
+}
+
+// writeFiles writes each file to its path under dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		assert.NilError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		assert.NilError(t, os.WriteFile(p, []byte(content), 0o644))
+	}
+}
+
+func TestOrgSubtreeExport(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "src")
+	writeFiles(t, dir, map[string]string{
+		"cold/notes.org": `#+TITLE: My Notes
+#+FILENAME: notes.html
+#+CATEGORY: kiln
+
+* Shopping
+Not published.
+* Building a /Kiln/
+:PROPERTIES:
+:EXPORT_FILE_NAME: kiln
+:EXPORT_DATE: <2024-01-02 Tue>
+:TYPE: post
+:END:
+Start with bricks.
+** Bricks
+Bricks are good.
+* Secret plans :noexport:
+:PROPERTIES:
+:EXPORT_FILE_NAME: secret
+:END:
+* Firing
+:PROPERTIES:
+:EXPORT_FILE_NAME: firing
+:EXPORT_TITLE: Firing the Kiln
+:END:
+Hot.
+`,
+		"cold/plain.org": "#+TITLE: Plain\n\n* Heading\nText.\n",
+	})
+
+	s := &Substructure{cfg: &Config{}, docs: &documents{}}
+	assert.NilError(t, s.discoverDocuments(dir))
+	var srcs []string
+	for _, doc := range s.docs.All {
+		srcs = append(srcs, doc.Metadata().SourcePath)
+	}
+	notes := filepath.Join(dir, "cold", "notes.org")
+	assert.DeepEqual(t, srcs, []string{
+		notes + "::kiln",
+		notes + "::firing",
+		filepath.Join(dir, "cold", "plain.org"),
+	})
+
+	kiln, got := loadOrg(t, notes+"::kiln")
+	assert.Equal(t, kiln.meta.Title, "Building a Kiln")
+	assert.Equal(t, kiln.meta.WebPath, "/kiln.html")
+	assert.Equal(t, kiln.meta.Category, "kiln")
+	assert.Equal(t, kiln.meta.Kind, post)
+	assert.Equal(t, kiln.meta.CreatedAt, time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC))
+	assert.Assert(t, strings.Contains(got, "Start with bricks."), got)
+	assert.Assert(t, strings.Contains(got, "<h2"), got)
+	for _, unwanted := range []string{"Not published.", "Shopping", "Hot.", "My Notes"} {
+		assert.Assert(t, !strings.Contains(got, unwanted), "%s in %s", unwanted, got)
+	}
+	assert.Assert(t, kiln.DependsOn(notes))
+
+	firing, _ := loadOrg(t, notes+"::firing")
+	assert.Equal(t, firing.meta.Title, "Firing the Kiln")
+	assert.Equal(t, firing.meta.WebPath, "/firing.html")
+}
+
+func TestOrgResplit(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "src")
+	notes := filepath.Join(dir, "notes.org")
+	unsplit := "#+TITLE: Notes\n\n* Kiln\nHot.\n"
+	split := "#+TITLE: Notes\n\n* Kiln\n:PROPERTIES:\n:EXPORT_FILE_NAME: kiln\n:END:\nHot.\n"
+	writeFiles(t, dir, map[string]string{"notes.org": unsplit})
+	s := &Substructure{cfg: &Config{}, docs: &documents{}}
+	assert.NilError(t, s.discoverDocuments(dir))
+	srcs := func() []string {
+		var srcs []string
+		for _, doc := range s.docs.All {
+			srcs = append(srcs, doc.Metadata().SourcePath)
+		}
+		return srcs
+	}
+	assert.DeepEqual(t, srcs(), []string{notes})
+
+	writeFiles(t, dir, map[string]string{"notes.org": split})
+	assert.NilError(t, s.resplit(notes))
+	assert.DeepEqual(t, srcs(), []string{notes + "::kiln"})
+	doc, ok := s.docBySourceLink(filepath.Join(dir, "other.md"), "notes.org")
+	assert.Assert(t, ok)
+	assert.Equal(t, doc.Metadata().SourcePath, notes+"::kiln")
+
+	writeFiles(t, dir, map[string]string{"notes.org": unsplit})
+	assert.NilError(t, s.resplit(notes))
+	assert.DeepEqual(t, srcs(), []string{notes})
+}
+
+func TestOrgIncludes(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"main.org":          "#+TITLE: Main\n\nBefore.\n\n#+INCLUDE: \"parts/chapter.org\"\n\nAfter.\n\n#+INCLUDE: \"parts/hello.go\" src go\n",
+		"parts/chapter.org": "Chapter text.\n\n#+INCLUDE: \"section.org\"\n",
+		"parts/section.org": "Section text.\n",
+		"parts/hello.go":    "package main\n",
+		"loop.org":          "#+INCLUDE: \"loop.org\"\n",
+		"missing.org":       "#+INCLUDE: \"nope.org\"\n",
+	})
+
+	doc, got := loadOrg(t, filepath.Join(dir, "main.org"))
+	for _, want := range []string{"Before.", "Chapter text.", "Section text.", "After.", `<span class="kn">package</span>`} {
+		assert.Assert(t, strings.Contains(got, want), "missing %s in %s", want, got)
+	}
+	for _, dep := range []string{"parts/chapter.org", "parts/section.org", "parts/hello.go"} {
+		assert.Assert(t, doc.DependsOn(filepath.Join(dir, dep)), "does not depend on %s", dep)
+	}
+
+	for _, name := range []string{"loop.org", "missing.org"} {
+		src := filepath.Join(dir, name)
+		meta := NewMetadata(src, filepath.Join("testdata", "templates"))
+		doc := NewOrgDocument(src, meta, NewHTMLDocument(src, meta, nil, nil))
+		b, err := os.ReadFile(src)
+		assert.NilError(t, err)
+		assert.ErrorContains(t, doc.Load(strings.NewReader(string(b))), "cannot include")
+	}
+}
+
+func TestOrgProperties(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"page.org": `:PROPERTIES:
+:TYPE: post
+:SERIES: Kilns
+:SERIES_ORDER: 2
+:END:
+#+TITLE: Page
+#+DATE: [2023-05-06 Sat 10:00]
+
+Shown.
+
+* Draft section :noexport:
+Hidden.
+`,
+	})
+	doc, got := loadOrg(t, filepath.Join(dir, "page.org"))
+	assert.Equal(t, doc.meta.Title, "Page")
+	assert.Equal(t, doc.meta.Kind, post)
+	assert.Equal(t, doc.meta.Series, "Kilns")
+	assert.Equal(t, doc.meta.SeriesOrder, 2)
+	assert.Equal(t, doc.meta.CreatedAt, time.Date(2023, time.May, 6, 0, 0, 0, 0, time.UTC))
+	assert.Assert(t, strings.Contains(got, "Shown."), got)
+	assert.Assert(t, !strings.Contains(got, "Hidden."), got)
+	assert.Assert(t, !strings.Contains(got, "Draft section"), got)
+}
+
+func TestOrgGemini(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"page.org": `#+TITLE: Building a /Kiln/
+
+Start with [[file:bricks.org][bricks]]
+and read [[https://example.com][the manual]].
+
+* Materials
+- Bricks
+- Mortar
+  1. Sand
+  2. Water
+
+** Firing
+#+BEGIN_SRC go
+package main
+
+func main() {}
+#+END_SRC
+
+#+BEGIN_QUOTE
+Hot.
+#+END_QUOTE
+
+| Cone | Temp |
+|------+------|
+|   10 | 1300 |
+
+* Draft :noexport:
+Hidden.
+`,
+	})
+	doc, _ := loadOrg(t, filepath.Join(dir, "page.org"))
+	var buf strings.Builder
+	assert.NilError(t, doc.RenderGemini(&buf))
+	assert.Equal(t, buf.String(), "# Building a Kiln\n"+
+		"\n"+
+		"Start with bricks and read the manual.\n"+
+		"\n"+
+		"=> /bricks.gmi bricks\n"+
+		"=> https://example.com the manual\n"+
+		"\n"+
+		"# Materials\n"+
+		"\n"+
+		"* Bricks\n"+
+		"* Mortar\n"+
+		"* 1. Sand\n"+
+		"* 2. Water\n"+
+		"\n"+
+		"## Firing\n"+
+		"\n"+
+		"```go\n"+
+		"package main\n"+
+		"\n"+
+		"func main() {}\n"+
+		"```\n"+
+		"\n"+
+		"> Hot.\n"+
+		"\n"+
+		"```\n"+
+		"Cone | Temp\n"+
+		"10   | 1300\n"+
+		"```\n")
+}
+
+func TestGemtextLinkTarget(t *testing.T) {
+	var docs []Document
+	for _, src := range []string{"bricks.org", "notes.org::kiln", "notes.org::firing"} {
+		docs = append(docs, testDoc{meta: NewMetadata(filepath.Join("src", "test", src), "")})
+	}
+	s := &Substructure{
+		cfg:  &Config{},
+		docs: &documents{All: docs},
+		splits: map[string][]string{
+			filepath.Join("src", "test", "notes.org"): {
+				docs[1].Metadata().SourcePath,
+				docs[2].Metadata().SourcePath,
+			},
+		},
+	}
+
+	for _, test := range []struct {
+		url  string
+		want string
+		s    *Substructure
+	}{
+		{url: "file:bricks.org", want: "/bricks.gmi", s: s},
+		{url: "file:bricks.org::kiln", want: "/bricks.gmi", s: s},
+		{url: "notes.org::kiln", want: "/kiln.gmi", s: s},
+		{url: "file:notes.org::firing", want: "/firing.gmi", s: s},
+		{url: "file:notes.org", want: "/kiln.gmi", s: s},
+		{url: "file:notes.org::*Firing", want: "/kiln.gmi", s: s},
+		{url: "file:notes.org::12", want: "/kiln.gmi", s: s},
+		{url: "https://example.com/a::b", want: "https://example.com/a::b", s: s},
+		{url: "file:bricks.org::kiln", want: "/bricks.gmi"},
+	} {
+		t.Run(test.url, func(t *testing.T) {
+			doc := org.New().Parse(strings.NewReader("[["+test.url+"]]"), "page.org")
+			p := doc.Nodes[0].(org.Paragraph)
+			w := &orgGemtextWriter{s: test.s, src: filepath.Join("src", "test", "page.org")}
+			got, ok := w.linkTarget(p.Children[0].(org.RegularLink))
+			assert.Assert(t, ok)
+			assert.Equal(t, got, test.want)
+		})
+	}
+}
+
+func TestOrgTOCMarker(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"page.org": `#+TITLE: Kiln
+#+TOC: true
+
+Intro.
+
+[[toc]]
+
+* Fire
+** Heat
+`,
+	})
+	doc, got := loadOrg(t, filepath.Join(dir, "page.org"))
+	assert.Assert(t, strings.Contains(got, `<ol id="toc">`), got)
+	assert.Assert(t, strings.Index(got, "Intro.") < strings.Index(got, `<ol id="toc">`), got)
+	assert.Assert(t, !strings.Contains(got, "[[toc]]") && !strings.Contains(got, `href="toc"`), got)
+
+	var gemtext strings.Builder
+	assert.NilError(t, doc.RenderGemini(&gemtext))
+	assert.Assert(t, !strings.Contains(gemtext.String(), "toc"), gemtext.String())
+}
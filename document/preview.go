@@ -0,0 +1,205 @@
+package document // import "twos.dev/winter/document"
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const (
+	// defaultPreviewLength is the maximum length, in characters,
+	// of a generated preview when the configuration does not specify one.
+	defaultPreviewLength = 200
+	// moreMarker is the content of an HTML comment that marks the end of a document's summary,
+	// as in <!--more-->.
+	moreMarker = "more"
+)
+
+// setPreview sets the document's rich HTML summary,
+// and its plain text preview if one wasn't manually specified.
+//
+// If the document contains a <!--more--> marker,
+// everything before it is the summary,
+// and the preview is its full text.
+// Otherwise the summary is the first paragraph that contains any words,
+// and the preview is its text,
+// shortened to the configured length at a sentence or word boundary.
+func (doc *HTMLDocument) setPreview() error {
+	doc.meta.Summary = ""
+	body := firstTag(doc.root, atom.Body)
+	if body == nil {
+		return nil
+	}
+
+	var nodes []*html.Node
+	explicit := false
+	if summary := beforeMarker(body); summary != nil {
+		explicit = true
+		for n := summary.FirstChild; n != nil; n = n.NextSibling {
+			nodes = append(nodes, n)
+		}
+	} else {
+		for _, p := range allOfTypes(body, map[atom.Atom]struct{}{atom.P: {}}) {
+			if countWords(stripTemplateActions(text(p))) > 0 {
+				nodes = append(nodes, p)
+				break
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	var words []string
+	for _, n := range nodes {
+		if err := html.Render(&buf, withoutTemplateActions(n)); err != nil {
+			return fmt.Errorf("cannot render summary of %s: %w", doc.meta.SourcePath, err)
+		}
+		words = append(words, strings.Fields(stripTemplateActions(text(n)))...)
+	}
+	doc.meta.Summary = template.HTML(strings.TrimSpace(buf.String()))
+
+	if doc.meta.Preview != "" {
+		return nil
+	}
+	doc.meta.Preview = strings.Join(words, " ")
+	if !explicit {
+		length := defaultPreviewLength
+		if doc.s != nil && doc.s.cfg != nil && doc.s.cfg.PreviewLength > 0 {
+			length = doc.s.cfg.PreviewLength
+		}
+		doc.meta.Preview = truncate(doc.meta.Preview, length)
+	}
+	return nil
+}
+
+// beforeMarker returns a copy of body holding only the content that comes before its <!--more--> marker.
+// If body has no marker, beforeMarker returns nil.
+func beforeMarker(body *html.Node) *html.Node {
+	hasMarker := func(n *html.Node) bool {
+		return n.Type == html.CommentNode && strings.TrimSpace(n.Data) == moreMarker
+	}
+	found := false
+	for _, n := range allOfNodeTypes(body, map[html.NodeType]struct{}{html.CommentNode: {}}) {
+		if hasMarker(n) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil
+	}
+
+	c := deepCopy(body)
+	var marker *html.Node
+	for _, n := range allOfNodeTypes(c, map[html.NodeType]struct{}{html.CommentNode: {}}) {
+		if hasMarker(n) {
+			marker = n
+			break
+		}
+	}
+	// Cut the marker and everything after it at every level up to the body.
+	for n := marker; n != c; n = n.Parent {
+		for n.NextSibling != nil {
+			n.Parent.RemoveChild(n.NextSibling)
+		}
+	}
+	marker.Parent.RemoveChild(marker)
+	return c
+}
+
+// withoutTemplateActions returns a copy of n without any template actions in its text or attributes,
+// leaving out attributes that held nothing else.
+//
+// The summary is taken before the document's templates are executed,
+// so its actions are left out rather than shown as written.
+func withoutTemplateActions(n *html.Node) *html.Node {
+	c := deepCopy(n)
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			n.Data = replaceTemplateActions(n.Data, "")
+		}
+		attrs := n.Attr[:0]
+		for _, a := range n.Attr {
+			if v := replaceTemplateActions(a.Val, ""); v != "" || v == a.Val {
+				a.Val = v
+				attrs = append(attrs, a)
+			}
+		}
+		n.Attr = attrs
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(c)
+	return c
+}
+
+// deepCopy returns a copy of n and all its descendants,
+// detached from any parent or siblings.
+func deepCopy(n *html.Node) *html.Node {
+	c := &html.Node{
+		Type:      n.Type,
+		DataAtom:  n.DataAtom,
+		Data:      n.Data,
+		Namespace: n.Namespace,
+		Attr:      append([]html.Attribute(nil), n.Attr...),
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		c.AppendChild(deepCopy(child))
+	}
+	return c
+}
+
+// text returns the text content of n and its descendants,
+// leaving out code blocks, scripts, styles,
+// and the TeX source of rendered math.
+func text(n *html.Node) string {
+	switch n.DataAtom {
+	case atom.Pre, atom.Script, atom.Style:
+		return ""
+	}
+	if n.Type == html.ElementNode && n.Data == "annotation" {
+		return ""
+	}
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		b.WriteString(text(child))
+	}
+	return b.String()
+}
+
+// truncate shortens s to at most length characters.
+//
+// It cuts after the last sentence that fits,
+// as long as that keeps at least half of length;
+// otherwise it cuts at the last word boundary that fits and appends an ellipsis.
+func truncate(s string, length int) string {
+	runes := []rune(s)
+	if len(runes) <= length {
+		return s
+	}
+	for i := length - 1; i >= length/2; i-- {
+		switch runes[i] {
+		case '.', '!', '?':
+			if unicode.IsSpace(runes[i+1]) {
+				return string(runes[:i+1])
+			}
+		case '。', '！', '？':
+			return string(runes[:i+1])
+		}
+	}
+	for i := length; i > 0; i-- {
+		if unicode.IsSpace(runes[i]) {
+			return strings.TrimRight(string(runes[:i]), ",;:–—-") + "…"
+		}
+	}
+	return string(runes[:length]) + "…"
+}
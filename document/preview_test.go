@@ -0,0 +1,69 @@
+package document // import "twos.dev/winter/document"
+
+import (
+	"html/template"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestHTMLPreview(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		input   string
+		preview string
+		summary template.HTML
+	}{
+		{
+			name:    "LeadingLink",
+			input:   `<p><a href="https://example.com">Kilns</a> get <em>very</em> hot. Be careful.</p><p>Second.</p>`,
+			preview: "Kilns get very hot.",
+			summary: `<p><a href="https://example.com" target="_blank">Kilns</a> get <em>very</em> hot. Be careful.</p>`,
+		},
+		{
+			name:    "SkipsEmptyParagraphs",
+			input:   `<p><img src="/kiln.jpg" alt=""/></p><p>{{ template "_icon.html.tmpl" }}</p><p>The kiln.</p>`,
+			preview: "The kiln.",
+			summary: `<p>The kiln.</p>`,
+		},
+		{
+			name:    "TemplateActions",
+			input:   `<p>Fired {{ if .Title }}twice {{ end }}at <a href="{{ .WebPath }}">cone 10</a>.</p>`,
+			preview: "Fired twice at cone 10.",
+			summary: `<p>Fired twice at <a>cone 10</a>.</p>`,
+		},
+		{
+			name:    "Sentence",
+			input:   `<p>Kilns get hot. Very hot indeed, hotter than you would expect.</p>`,
+			preview: "Kilns get hot.",
+			summary: `<p>Kilns get hot. Very hot indeed, hotter than you would expect.</p>`,
+		},
+		{
+			name:    "Word",
+			input:   `<p>Kilns get incredibly, unbelievably, unreasonably hot.</p>`,
+			preview: "Kilns get incredibly…",
+			summary: `<p>Kilns get incredibly, unbelievably, unreasonably hot.</p>`,
+		},
+		{
+			name:    "MoreMarker",
+			input:   `<p>Kilns get incredibly, unbelievably, unreasonably hot.</p><p>Wear gloves.<!--more--> Or don't.</p><p>Later.</p>`,
+			preview: "Kilns get incredibly, unbelievably, unreasonably hot. Wear gloves.",
+			summary: `<p>Kilns get incredibly, unbelievably, unreasonably hot.</p><p>Wear gloves.</p>`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			src := "src/test/" + test.name
+			doc := NewHTMLDocument(
+				src,
+				NewMetadata(src, filepath.Join("testdata", "templates")),
+				&Substructure{cfg: &Config{PreviewLength: 24}},
+				nil,
+			)
+			assert.NilError(t, doc.Load(strings.NewReader(test.input)))
+			assert.Equal(t, doc.Metadata().Preview, test.preview)
+			assert.Equal(t, doc.Metadata().Summary, test.summary)
+		})
+	}
+}
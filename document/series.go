@@ -0,0 +1,227 @@
+package document // import "twos.dev/winter/document"
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// seriesBody is the body of an automatically generated series overview page,
+	// used when the template directory has no seriesTmpl.
+	seriesBody = `{{ with series %q }}<ol class="series">{{ range .Parts }}
+<li><a href="{{ .Metadata.WebPath }}">{{ .Metadata.Title }}</a></li>{{ end }}
+</ol>{{ end }}`
+	seriesTmpl = "_series.html.tmpl"
+)
+
+// series is an ordered collection of documents that share a series frontmatter value,
+// such as the parts of a multi-part article.
+type series struct {
+	// Name is the name of the series, as given in frontmatter.
+	Name string
+	// Parts are the documents in the series, ordered by SeriesOrder.
+	Parts []Document
+	// WebPath is the path component of the URL of the series overview page.
+	WebPath string
+}
+
+// seriesWebPath returns the web path of the overview page for the series with the given name.
+//
+// For example, the series "Building a Kiln" has the overview page /building-a-kiln.html.
+func seriesWebPath(name string) string {
+	return fmt.Sprintf("/%s.html", slugify(name))
+}
+
+// seriesNamed returns the series called name made up of docs,
+// with its parts ordered by SeriesOrder.
+//
+// Only parts listed at time now are included;
+// see [Metadata.ListedAt].
+// If no part is listed, seriesNamed returns nil.
+func seriesNamed(docs []Document, name string, now time.Time, future bool) *series {
+	if name == "" {
+		return nil
+	}
+	sr := series{Name: name, WebPath: seriesWebPath(name)}
+	for _, doc := range docs {
+		if doc.Metadata().Series == name && doc.Metadata().ListedAt(now, future) {
+			sr.Parts = append(sr.Parts, doc)
+		}
+	}
+	if len(sr.Parts) == 0 {
+		return nil
+	}
+	sort.SliceStable(sr.Parts, func(i, j int) bool {
+		return sr.Parts[i].Metadata().SeriesOrder < sr.Parts[j].Metadata().SeriesOrder
+	})
+	return &sr
+}
+
+// index returns the 0-based position of the document with the given metadata in sr,
+// or -1 if it is not a part of sr.
+func (sr *series) index(meta *Metadata) int {
+	if sr == nil {
+		return -1
+	}
+	for i, part := range sr.Parts {
+		if part.Metadata() == meta {
+			return i
+		}
+	}
+	return -1
+}
+
+// seriesNames returns the names of all series among the substructure's documents, sorted.
+func (s *Substructure) seriesNames() []string {
+	seen := map[string]struct{}{}
+	var names []string
+	for _, doc := range s.docs.All {
+		name := doc.Metadata().Series
+		if name == "" {
+			continue
+		}
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// isSeriesSibling returns true if and only if doc is a different part of the same series as the document at src.
+// Parts link to each other,
+// so a change to one should rebuild the others.
+func (s *Substructure) isSeriesSibling(doc Document, src string) bool {
+	if doc.Metadata().Series == "" || doc.Metadata().SourcePath == src {
+		return false
+	}
+	changed, ok := s.DocBySourcePath(src)
+	if !ok {
+		return false
+	}
+	return changed.Metadata().Series == doc.Metadata().Series
+}
+
+// validateSeries returns an error if any series is inconsistent.
+//
+// A series is consistent when every part has a series_order,
+// no two parts share one,
+// and the orders count up from 1 without skipping a number.
+// A document with a series_order but no series is also an error.
+func (s *Substructure) validateSeries() error {
+	var problems []string
+	byName := map[string][]*Metadata{}
+	for _, doc := range s.docs.All {
+		meta := doc.Metadata()
+		if meta.Series == "" {
+			if meta.SeriesOrder != 0 {
+				problems = append(problems, fmt.Sprintf(
+					"%s has series_order %d but no series",
+					meta.SourcePath,
+					meta.SeriesOrder,
+				))
+			}
+			continue
+		}
+		byName[meta.Series] = append(byName[meta.Series], meta)
+	}
+	for _, name := range s.seriesNames() {
+		parts := byName[name]
+		orders := map[int]string{}
+		for _, meta := range parts {
+			if meta.SeriesOrder <= 0 {
+				problems = append(problems, fmt.Sprintf(
+					"%s is in series %q but has no positive series_order",
+					meta.SourcePath,
+					name,
+				))
+				continue
+			}
+			if prev, ok := orders[meta.SeriesOrder]; ok {
+				problems = append(problems, fmt.Sprintf(
+					"%s and %s both have series_order %d in series %q",
+					prev,
+					meta.SourcePath,
+					meta.SeriesOrder,
+					name,
+				))
+				continue
+			}
+			orders[meta.SeriesOrder] = meta.SourcePath
+		}
+		if len(orders) != len(parts) {
+			// Problems with this series have already been reported.
+			continue
+		}
+		for i := 1; i <= len(parts); i++ {
+			if _, ok := orders[i]; !ok {
+				problems = append(problems, fmt.Sprintf(
+					"series %q has %d parts but no part with series_order %d",
+					name,
+					len(parts),
+					i,
+				))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf(
+			"inconsistent series:\n\n- %s",
+			strings.Join(problems, "\n- "),
+		)
+	}
+	return nil
+}
+
+// writeSeries builds an overview page for every series.
+//
+// If a document already builds to the overview page's web path,
+// that document is the overview and none is generated.
+func (s *Substructure) writeSeries(builtDocs map[string]Document) error {
+	for _, name := range s.seriesNames() {
+		webPath := seriesWebPath(name)
+		if _, ok := builtDocs[webPath]; ok {
+			slog.Debug(fmt.Sprintf("Using %s as the overview of series %q.", webPath, name))
+			continue
+		}
+		doc, err := s.newSeriesDocument(name)
+		if err != nil {
+			return err
+		}
+		if err := s.buildWWW(doc); err != nil {
+			return fmt.Errorf("cannot build overview of series %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// newSeriesDocument returns a loaded document for the overview page of the series called name.
+//
+// The page lists the parts of the series using src/templates/_series.html.tmpl,
+// or a plain ordered list if that template does not exist.
+// The template is executed with the series as its data.
+func (s *Substructure) newSeriesDocument(name string) (Document, error) {
+	meta := &Metadata{
+		Kind:        page,
+		Layout:      filepath.Join(tmplPath, "text_document.html.tmpl"),
+		TemplateDir: tmplPath,
+		Title:       name,
+		WebPath:     seriesWebPath(name),
+	}
+	body := fmt.Sprintf(seriesBody, name)
+	if _, err := os.Stat(filepath.Join(meta.TemplateDir, seriesTmpl)); err == nil {
+		body = fmt.Sprintf("{{ template %q (series %q) }}", seriesTmpl, name)
+	}
+	doc := NewTemplateDocument(meta.WebPath, meta, s.templates, nil)
+	if err := doc.Load(strings.NewReader(body)); err != nil {
+		return nil, fmt.Errorf("cannot load overview of series %q: %w", name, err)
+	}
+	return doc, nil
+}
@@ -0,0 +1,125 @@
+package document // import "twos.dev/winter/document"
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func seriesDocument(title, name string, order int) Document {
+	doc := testDocument(title, post, time.Date(2024, time.January, order, 0, 0, 0, 0, time.UTC))
+	doc.Metadata().Series = name
+	doc.Metadata().SeriesOrder = order
+	return doc
+}
+
+func TestTemplateDocumentSeriesFuncs(t *testing.T) {
+	docs := &documents{}
+	first := seriesDocument("Part One", "Building a Kiln", 1)
+	second := seriesDocument("Part Two", "Building a Kiln", 2)
+	third := seriesDocument("Part Three", "Building a Kiln", 3)
+	docs.add(third)
+	docs.add(first)
+	docs.add(second)
+	docs.add(testDocument("Unrelated", post, time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)))
+
+	doc := NewTemplateDocument(
+		second.Metadata().SourcePath,
+		second.Metadata(),
+		newTemplates(nil, docs, nil, nil),
+		nil,
+	)
+
+	sr := doc.seriesFunc()
+	assert.Assert(t, sr != nil)
+	assert.Equal(t, sr.Name, "Building a Kiln")
+	assert.Equal(t, sr.WebPath, "/building-a-kiln.html")
+	assert.Equal(t, len(sr.Parts), 3)
+	assert.Equal(t, doc.seriesIndexFunc(), 2)
+	assert.Equal(t, doc.prevPartFunc(), first)
+	assert.Equal(t, doc.nextPartFunc(), third)
+
+	standalone := NewTemplateDocument(
+		"src/test/standalone",
+		NewMetadata("src/test/standalone", filepath.Join("testdata", "templates")),
+		newTemplates(nil, docs, nil, nil),
+		nil,
+	)
+	assert.Assert(t, standalone.seriesFunc() == nil)
+	assert.Equal(t, standalone.seriesIndexFunc(), 0)
+	assert.Assert(t, standalone.prevPartFunc() == nil)
+	assert.Assert(t, standalone.nextPartFunc() == nil)
+}
+
+func TestValidateSeries(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		docs  []Document
+		valid bool
+	}{
+		{
+			name: "Consistent",
+			docs: []Document{
+				seriesDocument("One", "Kiln", 1),
+				seriesDocument("Two", "Kiln", 2),
+			},
+			valid: true,
+		},
+		{
+			name: "Duplicate",
+			docs: []Document{
+				seriesDocument("One", "Kiln", 1),
+				seriesDocument("Also One", "Kiln", 1),
+			},
+		},
+		{
+			name: "Gap",
+			docs: []Document{
+				seriesDocument("One", "Kiln", 1),
+				seriesDocument("Three", "Kiln", 3),
+			},
+		},
+		{
+			name: "MissingOrder",
+			docs: []Document{
+				seriesDocument("One", "Kiln", 1),
+				seriesDocument("Unordered", "Kiln", 0),
+			},
+		},
+		{
+			name: "OrderWithoutSeries",
+			docs: []Document{
+				seriesDocument("Orphan", "", 1),
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			s := Substructure{docs: &documents{All: test.docs}}
+			err := s.validateSeries()
+			if test.valid {
+				assert.NilError(t, err)
+			} else {
+				assert.ErrorContains(t, err, "inconsistent series")
+			}
+		})
+	}
+}
+
+func TestExecuteAllValidatesSeriesFirst(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeFiles(t, src, map[string]string{
+		"one.md":      "---\nseries: Kiln\nseries_order: 1\n---\n# One\n",
+		"also-one.md": "---\nseries: Kiln\nseries_order: 1\n---\n# Also One\n",
+	})
+	cfg := &Config{Dist: filepath.Join(dir, "dist")}
+	s := &Substructure{cfg: cfg, docs: &documents{}}
+	assert.NilError(t, s.discoverDocuments(src))
+
+	assert.ErrorContains(t, s.ExecuteAll(cfg.Dist), "inconsistent series")
+	_, err := os.Stat(cfg.Dist)
+	assert.Assert(t, os.IsNotExist(err), "dist was written to: %v", err)
+}
@@ -0,0 +1,234 @@
+package document // import "twos.dev/winter/document"
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// sidenoteTmpl is the partial template that renders sidenotes,
+// given sidenoteVars.
+const sidenoteTmpl = "_sidenote.html.tmpl"
+
+// defaultSidenote renders a sidenote as a numbered reference followed by the note.
+var defaultSidenote = template.Must(template.New(sidenoteTmpl).Parse(
+	`<sup class="sidenote-ref"><a href="#{{ .ID }}" aria-describedby="{{ .ID }}">{{ .Number }}</a></sup>` +
+		`<span class="sidenote" id="{{ .ID }}" role="note"><span class="sidenote-number">{{ .Number }}</span> {{ .Body }}</span>`,
+))
+
+// sidenoteVars describe one footnote moved beside its reference.
+type sidenoteVars struct {
+	// Number is the footnote's number as shown at its reference,
+	// such as 1.
+	Number string
+	// ID is the ID of the sidenote,
+	// unique within the document.
+	ID string
+	// Body is the content of the footnote,
+	// with its paragraphs joined by line breaks
+	// so it can sit inside the paragraph that references it.
+	Body template.HTML
+}
+
+// sidenotesEnabled reports whether the site moves footnotes into sidenotes.
+func (doc *HTMLDocument) sidenotesEnabled() bool {
+	return doc.s != nil && doc.s.cfg != nil && doc.s.cfg.Footnotes.Sidenotes
+}
+
+// insertSidenotes moves each footnote out of the list at the end of the document
+// and next to its first reference,
+// rendered by src/templates/_sidenote.html.tmpl,
+// or as a <span class="sidenote"> if that template does not exist.
+// Later references to the same footnote link to the sidenote.
+//
+// Footnotes holding more than paragraphs and inline content,
+// such as lists or code blocks,
+// cannot sit inside a paragraph,
+// so they stay in the list;
+// the list is removed once it is empty.
+//
+// Footnotes from Markdown and Org are both recognized.
+// The document as it was before is kept for feeds,
+// whose readers show no sidenotes.
+func (doc *HTMLDocument) insertSidenotes() error {
+	if !doc.sidenotesEnabled() {
+		return nil
+	}
+	footnotes := findFootnotes(doc.root)
+	if footnotes == nil {
+		return nil
+	}
+	defs := map[string]*html.Node{}
+	for _, n := range allOfTypes(footnotes, map[atom.Atom]struct{}{atom.Li: {}, atom.Sup: {}}) {
+		if id := attr(n, atom.Id); id != "" {
+			defs[id] = n
+		}
+	}
+
+	var tmpl *template.Template
+	moved := map[string]string{}
+	for _, ref := range allOfTypes(doc.root, map[atom.Atom]struct{}{atom.Sup: {}}) {
+		if !hasClass(ref, "footnote-ref") && !hasClass(ref, "footnote-reference") {
+			continue
+		}
+		a := firstTag(ref, atom.A)
+		if a == nil {
+			continue
+		}
+		target := strings.TrimPrefix(attr(a, atom.Href), "#")
+		if id, ok := moved[target]; ok {
+			setAttr(a, atom.Href, "#"+id)
+			continue
+		}
+		def, ok := defs[target]
+		if !ok {
+			continue
+		}
+		body, container := footnoteBody(def)
+		if body == nil {
+			continue
+		}
+		inline, ok := inlineFootnote(body)
+		if !ok {
+			continue
+		}
+
+		if doc.feedRoot == nil {
+			doc.feedRoot = deepCopy(doc.root)
+		}
+		if tmpl == nil {
+			var err error
+			if tmpl, err = doc.partialOr(sidenoteTmpl, defaultSidenote); err != nil {
+				return err
+			}
+		}
+		number := strings.TrimSpace(text(a))
+		id := "sidenote-" + number
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, sidenoteVars{Number: number, ID: id, Body: inline}); err != nil {
+			return fmt.Errorf("cannot execute %s for %s: %w", sidenoteTmpl, doc.meta.SourcePath, err)
+		}
+		nodes, err := html.ParseFragment(&buf, ref.Parent)
+		if err != nil {
+			return fmt.Errorf("cannot parse sidenote in %s: %w", doc.meta.SourcePath, err)
+		}
+		for _, n := range nodes {
+			ref.Parent.InsertBefore(n, ref)
+		}
+		ref.Parent.RemoveChild(ref)
+		container.Parent.RemoveChild(container)
+		moved[target] = id
+	}
+
+	if len(allOfTypes(footnotes, map[atom.Atom]struct{}{atom.Li: {}, atom.Sup: {}})) == 0 {
+		footnotes.Parent.RemoveChild(footnotes)
+	}
+	return nil
+}
+
+// findFootnotes returns the element holding the list of footnotes at the end of the document,
+// or nil if it has none.
+func findFootnotes(n *html.Node) *html.Node {
+	if n.DataAtom == atom.Div && hasClass(n, "footnotes") {
+		return n
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if f := findFootnotes(child); f != nil {
+			return f
+		}
+	}
+	return nil
+}
+
+// footnoteBody returns the element whose children are the content of the footnote def,
+// and the element to remove from the list of footnotes once the footnote is moved.
+//
+// In Markdown,
+// def is the footnote's list item.
+// In Org,
+// def is the number heading the footnote's definition,
+// which is followed by its body.
+func footnoteBody(def *html.Node) (body, container *html.Node) {
+	if def.DataAtom == atom.Li {
+		return def, def
+	}
+	container = def.Parent
+	if container == nil || !hasClass(container, "footnote-definition") {
+		return nil, nil
+	}
+	for child := container.FirstChild; child != nil; child = child.NextSibling {
+		if hasClass(child, "footnote-body") {
+			return child, container
+		}
+	}
+	return nil, nil
+}
+
+// inlineFootnote returns the content of footnote body as HTML that can sit inside a paragraph,
+// with paragraphs joined by line breaks.
+// If body holds other blocks,
+// ok is false.
+func inlineFootnote(body *html.Node) (inline template.HTML, ok bool) {
+	// Each paragraph is a part,
+	// as is each run of inline content between paragraphs.
+	var parts []string
+	var run bytes.Buffer
+	flush := func() {
+		if part := strings.TrimSpace(run.String()); part != "" {
+			parts = append(parts, part)
+		}
+		run.Reset()
+	}
+	for child := body.FirstChild; child != nil; child = child.NextSibling {
+		if child.DataAtom != atom.P {
+			if !isPhrasing(child) {
+				return "", false
+			}
+			if err := html.Render(&run, child); err != nil {
+				return "", false
+			}
+			continue
+		}
+		flush()
+		for c := child.FirstChild; c != nil; c = c.NextSibling {
+			if !isPhrasing(c) {
+				return "", false
+			}
+			if err := html.Render(&run, c); err != nil {
+				return "", false
+			}
+		}
+		flush()
+	}
+	flush()
+	return template.HTML(strings.Join(parts, "<br/>")), true
+}
+
+// phrasingBlockers are elements that cannot appear inside a paragraph.
+var phrasingBlockers = []atom.Atom{
+	atom.Blockquote, atom.Div, atom.Dl, atom.Figure, atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6,
+	atom.Hr, atom.Ol, atom.P, atom.Pre, atom.Table, atom.Ul,
+}
+
+// isPhrasing reports whether n and its descendants can appear inside a paragraph.
+func isPhrasing(n *html.Node) bool {
+	if slices.Contains(phrasingBlockers, n.DataAtom) {
+		return false
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if !isPhrasing(child) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasClass reports whether n has class among its classes.
+func hasClass(n *html.Node, class string) bool {
+	return slices.Contains(strings.Fields(attr(n, atom.Class)), class)
+}
@@ -0,0 +1,77 @@
+package document // import "twos.dev/winter/document"
+
+import (
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestInsertSidenotes(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		ext     string
+		input   string
+		want    []string
+		wantNot []string
+	}{
+		{
+			name:  "Markdown",
+			ext:   ".md",
+			input: "Hot[^1] kiln[^1].\n\n[^1]: Very *hot*.\n",
+			want: []string{
+				`<p>Hot<sup class="sidenote-ref"><a href="#sidenote-1" aria-describedby="sidenote-1">1</a></sup><span class="sidenote" id="sidenote-1" role="note"><span class="sidenote-number">1</span> Very <em>hot</em>.</span> kiln<sup class="footnote-ref" id="fnref:1"><a href="#sidenote-1">1</a></sup>.</p>`,
+			},
+			wantNot: []string{`class="footnotes"`},
+		},
+		{
+			name:  "Org",
+			ext:   ".org",
+			input: "Hot[fn:1] kiln.\n\n* Footnotes\n[fn:1] Very hot.\n\nReally.\n",
+			want: []string{
+				`<span class="sidenote" id="sidenote-1" role="note"><span class="sidenote-number">1</span> Very hot.<br/>Really.</span> kiln.</p>`,
+			},
+			wantNot: []string{`class="footnotes"`},
+		},
+		{
+			name:  "BlockFootnoteStays",
+			ext:   ".md",
+			input: "Hot[^1] and cold[^2].\n\n[^1]: Very hot.\n\n[^2]: Cold:\n\n    ```\n    ice\n    ```\n",
+			want: []string{
+				`<span class="sidenote" id="sidenote-1" role="note">`,
+				`<sup class="footnote-ref" id="fnref:2"><a href="#fn:2">2</a></sup>`,
+				`<div class="footnotes">`,
+			},
+			wantNot: []string{`id="fn:1"`, `id="sidenote-2"`},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			s := &Substructure{cfg: &Config{}}
+			s.cfg.Footnotes.Sidenotes = true
+			doc := loadAs(t, test.ext, test.input, s)
+
+			var buf strings.Builder
+			assert.NilError(t, doc.Render(&buf))
+			for _, want := range test.want {
+				assert.Assert(t, strings.Contains(buf.String(), want), "missing %s in %s", want, buf.String())
+			}
+			for _, unwanted := range test.wantNot {
+				assert.Assert(t, !strings.Contains(buf.String(), unwanted), "unwanted %s in %s", unwanted, buf.String())
+			}
+
+			doc.Metadata().feed = true
+			var feed strings.Builder
+			assert.NilError(t, doc.Render(&feed))
+			assert.Assert(t, strings.Contains(feed.String(), `class="footnotes"`), feed.String())
+			assert.Assert(t, !strings.Contains(feed.String(), "sidenote"), feed.String())
+		})
+	}
+}
+
+func TestSidenotesDisabled(t *testing.T) {
+	doc := loadAs(t, ".md", "Hot[^1].\n\n[^1]: Very hot.\n", &Substructure{cfg: &Config{}})
+	var buf strings.Builder
+	assert.NilError(t, doc.Render(&buf))
+	assert.Assert(t, strings.Contains(buf.String(), `<li id="fn:1">Very hot.</li>`), buf.String())
+	assert.Assert(t, !strings.Contains(buf.String(), "sidenote"), buf.String())
+}
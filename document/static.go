@@ -1,6 +1,7 @@
 package document // import "twos.dev/winter/document"
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 )
@@ -10,9 +11,9 @@ import (
 type StaticDocument struct {
 	SourcePath string
 
+	body []byte
 	deps map[string]struct{}
 	meta *Metadata
-	r    io.Reader
 }
 
 // NewStaticDocument creates a new document whose original source is at path src,
@@ -41,7 +42,11 @@ func (doc *StaticDocument) DependsOn(src string) bool {
 }
 
 func (doc *StaticDocument) Load(r io.Reader) error {
-	doc.r = r
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("cannot read static file %q: %w", doc.SourcePath, err)
+	}
+	doc.body = body
 	return nil
 }
 
@@ -50,7 +55,7 @@ func (doc *StaticDocument) Metadata() *Metadata {
 }
 
 func (doc *StaticDocument) Render(w io.Writer) error {
-	if _, err := io.Copy(w, doc.r); err != nil {
+	if _, err := io.Copy(w, bytes.NewReader(doc.body)); err != nil {
 		return fmt.Errorf("cannot copy static file %q for render: %w", doc.SourcePath, err)
 	}
 	return nil
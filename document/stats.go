@@ -0,0 +1,132 @@
+package document // import "twos.dev/winter/document"
+
+import (
+	"math"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// defaultWordsPerMinute is the reading speed used to estimate reading time
+// when the configuration does not specify one.
+const defaultWordsPerMinute = 200
+
+// Stats holds figures derived from the content of a document.
+//
+// Only content written in the document source is counted.
+// Content generated by templates,
+// such as a list of every post,
+// is not known yet when HTML is massaged.
+type Stats struct {
+	// CodeBlocks is the number of code blocks in the document.
+	CodeBlocks int
+	// Headings is the number of headings in the document,
+	// not counting the title.
+	Headings int
+	// Images is the number of images in the document.
+	Images int
+	// ReadingTime is the estimated time it takes to read the document.
+	ReadingTime time.Duration
+	// Words is the number of words in the prose of the document,
+	// not counting the title or code blocks.
+	// Each Chinese, Japanese, or Korean ideograph or kana counts as a word,
+	// since those scripts do not separate words with spaces.
+	Words int
+}
+
+// Minutes returns the estimated reading time in whole minutes,
+// rounded up.
+// A document with any words at all takes at least one minute to read.
+func (st Stats) Minutes() int {
+	return int(math.Ceil(st.ReadingTime.Minutes()))
+}
+
+// setStats computes statistics about the document's content
+// and stores them in its metadata.
+func (doc *HTMLDocument) setStats() {
+	var st Stats
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		switch n.DataAtom {
+		case atom.Pre:
+			st.CodeBlocks++
+			return
+		case atom.Script, atom.Style:
+			return
+		case atom.Img:
+			st.Images++
+		case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+			st.Headings++
+		}
+		if n.Type == html.TextNode {
+			st.Words += countWords(stripTemplateActions(n.Data))
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc.root)
+
+	wpm := defaultWordsPerMinute
+	if doc.s != nil && doc.s.cfg != nil && doc.s.cfg.WordsPerMinute > 0 {
+		wpm = doc.s.cfg.WordsPerMinute
+	}
+	st.ReadingTime = time.Duration(st.Words) * time.Minute / time.Duration(wpm)
+	doc.meta.Stats = st
+}
+
+// countWords returns the number of words in s.
+//
+// Words are runs of letters and digits.
+// Each Han, Hiragana, or Katakana character is a word by itself.
+func countWords(s string) int {
+	var words int
+	inWord := false
+	for _, r := range s {
+		switch {
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana):
+			words++
+			inWord = false
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r):
+			if !inWord {
+				words++
+			}
+			inWord = true
+		case r == '\'' || r == '’' || r == '-':
+			// Contractions and hyphenated words stay one word.
+		default:
+			inWord = false
+		}
+	}
+	return words
+}
+
+// stripTemplateActions returns s without any template actions,
+// so that template code is not counted as words.
+// Each action is replaced by a space,
+// so the words around it are not run together.
+func stripTemplateActions(s string) string {
+	return replaceTemplateActions(s, " ")
+}
+
+// replaceTemplateActions returns s with each template action replaced by repl.
+// An unterminated action is dropped along with everything after it.
+func replaceTemplateActions(s, repl string) string {
+	start, end := string(templateStart), string(templateEnd)
+	var b strings.Builder
+	for {
+		before, after, ok := strings.Cut(s, start)
+		b.WriteString(before)
+		if !ok {
+			return b.String()
+		}
+		_, s, ok = strings.Cut(after, end)
+		if !ok {
+			return b.String()
+		}
+		b.WriteString(repl)
+	}
+}
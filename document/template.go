@@ -5,11 +5,9 @@ import (
 	"fmt"
 	"html/template"
 	"io"
-	"os"
-	"path/filepath"
+	"maps"
 	"sort"
 	"strings"
-	"text/template/parse"
 	"time"
 
 	"twos.dev/winter/graphic"
@@ -20,49 +18,41 @@ const (
 	tmplPath = "src/templates"
 )
 
+// literalTemplates replaces the Go template delimiters in text with actions that print them,
+// so text that only looks like a template,
+// such as code,
+// is shown as written.
+var literalTemplates = strings.NewReplacer("{{", `{{"{{"}}`, "}}", `{{"}}"}}`)
+
 // TemplateDocument represents a source file containing Go template clauses.
 // The surrounding syntax can be anything.
 //
-// Note that TemplateDocument does not handle layout-style templates,
-// where the document itself should be embedded in another template.
-// For that behavior, use LayoutDocument further down the load/render chain.
+// If the document has a layout,
+// TemplateDocument embeds the resolved document in it.
+// Templates are parsed and given their functions by the substructure's template environment,
+// so documents, layouts, and partials can all use the same functions.
 //
 // TemplateDocument implements [Document].
 //
 // The TemplateDocument is transitory;
 // its only purpose is to resolve templates then hand off the resolved source to another Document type.
 type TemplateDocument struct {
-	deps map[string]struct{}
-	// docs is a reference to the substructure's set of docs.
-	// It should be populated fully before any call to [TemplateDocument.Load],
-	// so that those calls can use the docs function in their [html/template.FuncMap] to discover and list docs.
-	docs *documents
-	meta *Metadata
-	next Document
-	// photos is a reference to the substructure's galleries.
-	// It should be populated fully before any call to [TemplateDocument.Load],
-	// so that those calls can use the gallery function in their [html/template.FuncMap] to discover and list images.
-	photos map[string][]*img
-	result []byte
-	// tmplDir is the path to the directory containing templates,
-	// usually src/templates.
-	tmplDir       string
+	docFuncs
+	deps          map[string]struct{}
+	next          Document
 	unparsedBytes []byte
 }
 
-// NewTemplateDocument returns a template document with the given pointers to existing document metadata,
-// substructure docs, and substructure photos.
-func NewTemplateDocument(src string, meta *Metadata, docs *documents, photos map[string][]*img, next Document) *TemplateDocument {
+// NewTemplateDocument returns a template document rendered in the template environment tmpls,
+// with the given pointer to existing document metadata.
+func NewTemplateDocument(src string, meta *Metadata, tmpls *templates, next Document) *TemplateDocument {
 	return &TemplateDocument{
+		docFuncs: docFuncs{env: tmpls, meta: meta},
 		deps: map[string]struct{}{
 			src:                {},
 			"public/style.css": {},
 		},
-		docs:    docs,
-		meta:    meta,
-		next:    next,
-		photos:  photos,
-		tmplDir: meta.TemplateDir,
+		next: next,
 	}
 }
 
@@ -74,8 +64,8 @@ func (doc *TemplateDocument) DependsOn(src string) bool {
 }
 
 // Load reads a Go template from r and loads it into doc.
-// Any templates referenced within are looked for looked for by name,
-// relative to the working directory.
+// Any templates referenced within are looked for by name,
+// relative to the document's template directory.
 //
 // To use a template, treat its filepath as a name:
 //
@@ -100,46 +90,26 @@ func (doc *TemplateDocument) Metadata() *Metadata {
 }
 
 func (doc *TemplateDocument) Render(w io.Writer) error {
-	funcs, err := doc.funcmap(doc.tmplDir)
+	return doc.renderBody(w, doc.unparsedBytes)
+}
+
+// renderBody is like Render,
+// but renders body in place of the template loaded into doc,
+// leaving what is loaded alone.
+func (doc *TemplateDocument) renderBody(w io.Writer, body []byte) error {
+	mainTmpl, files, err := doc.env.document(doc.meta, body)
 	if err != nil {
-		return fmt.Errorf("cannot generate funcmap for %q: %w", doc.meta.SourcePath, err)
-	}
-	var mainTmpl *template.Template
-	if doc.meta.Layout == "" {
-		tdoc, err := template.New(doc.meta.SourcePath).Funcs(funcs).Parse(string(doc.unparsedBytes))
-		if err != nil {
-			return fmt.Errorf("cannot parse template document %q: %w", doc.meta.SourcePath, err)
-		}
-		mainTmpl = tdoc
-	} else {
-		layoutBytes, err := os.ReadFile(doc.meta.Layout)
-		if err != nil {
-			return fmt.Errorf("cannot load template frontmatter for %q: %w", doc.meta.SourcePath, err)
-		}
-		layoutTmpl, err := template.New(doc.meta.Layout).Funcs(funcs).Parse(string(layoutBytes))
-		if err != nil {
-			return fmt.Errorf("cannot parse layout template %q for document %q: %w", doc.meta.Layout, doc.meta.SourcePath, err)
-		}
-		if _, err = layoutTmpl.New("body").Parse(string(doc.unparsedBytes)); err != nil {
-			return fmt.Errorf("cannot parse document %q for inclusion in layout %q: %w", doc.meta.SourcePath, doc.meta.Layout, err)
-		}
-		mainTmpl = layoutTmpl
+		return err
 	}
-	if err := loadDeps(doc.tmplDir, mainTmpl); err != nil {
-		return fmt.Errorf("cannot load dependencies for %q: %s", doc.meta.SourcePath, err)
-	}
-	for _, depTmpl := range mainTmpl.Templates() {
-		if depTmpl.Name() != "body" && depTmpl.Name() != doc.meta.SourcePath {
-			doc.deps[depTmpl.Name()] = struct{}{}
-		}
+	for _, f := range files {
+		doc.deps[f] = struct{}{}
 	}
 	var buf bytes.Buffer
 	if err := mainTmpl.Execute(&buf, doc.meta); err != nil {
 		return fmt.Errorf("cannot execute tmain for %q: %w", doc.meta.SourcePath, err)
 	}
-	doc.result = buf.Bytes()
 	if doc.next == nil {
-		if _, err := io.Copy(w, bytes.NewReader(doc.result)); err != nil {
+		if _, err := io.Copy(w, &buf); err != nil {
 			return fmt.Errorf("cannot render template document %q: %w", doc.meta.SourcePath, err)
 		}
 		return nil
@@ -150,16 +120,19 @@ func (doc *TemplateDocument) Render(w io.Writer) error {
 	return nil
 }
 
+// docFuncs are the functions available to templates,
+// bound to the document being rendered.
+type docFuncs struct {
+	env  *templates
+	meta *Metadata
+}
+
 // funcmap returns a [template.FuncMap] for the document.
 // It can be used with [html/template.Template.Funcs].
-func (doc *TemplateDocument) funcmap(tmplPath string) (template.FuncMap, error) {
-	iconFunc, err := icon(tmplPath)
-	if err != nil {
-		return nil, fmt.Errorf("cannot generate iconfunc: %w", err)
-	}
-	now := time.Now()
+func (f docFuncs) funcmap() template.FuncMap {
+	now := f.env.cfg.Now()
 
-	return template.FuncMap{
+	funcs := template.FuncMap{
 		"add": add,
 		"div": div,
 		"mul": mul,
@@ -167,59 +140,155 @@ func (doc *TemplateDocument) funcmap(tmplPath string) (template.FuncMap, error)
 
 		"now": func() time.Time { return now },
 
-		"gallery": doc.galleryFunc,
-		"icon":    iconFunc,
-		"render":  render,
-		"parent": func() Document {
-			if doc.meta.ParentFilename == "" {
-				return nil
-			}
-			for _, d := range doc.docs.All {
-				if strings.TrimPrefix(d.Metadata().WebPath, "/") == strings.TrimPrefix(doc.meta.ParentFilename, "/") {
-					return d
-				}
+		"gallery":     f.galleryFunc,
+		"graphic":     f.graphicFunc,
+		"icon":        f.iconFunc,
+		"render":      render,
+		"parent":      f.parentFunc,
+		"drafts":      f.draftsFunc,
+		"posts":       f.postsFunc,
+		"series":      f.seriesFunc,
+		"seriesIndex": f.seriesIndexFunc,
+		"prevPart":    f.prevPartFunc,
+		"nextPart":    f.nextPartFunc,
+		"yearly":      yearly,
+	}
+	maps.Copy(funcs, helpers(f.env.cfg))
+	return funcs
+}
+
+// parentFunc is a function to be used by templates.
+// It retrieves the document named by the document's parent property,
+// or nil if it has none.
+func (f docFuncs) parentFunc() Document {
+	if f.meta.ParentFilename == "" {
+		return nil
+	}
+	if f.env.docs != nil {
+		for _, d := range f.env.docs.All {
+			if strings.TrimPrefix(d.Metadata().WebPath, "/") == strings.TrimPrefix(f.meta.ParentFilename, "/") {
+				return d
 			}
-			panic(
-				fmt.Sprintf(
-					"%q says it has parent %q, but no such document exists; %s",
-					doc.meta.SourcePath,
-					doc.meta.ParentFilename,
-					"make sure it matches the filename property of another document",
-				),
-			)
-		},
-		"drafts": doc.draftsFunc,
-		"posts":  doc.postsFunc,
-		"yearly": yearly,
-	}, nil
+		}
+	}
+	panic(
+		fmt.Sprintf(
+			"%q says it has parent %q, but no such document exists; %s",
+			f.meta.SourcePath,
+			f.meta.ParentFilename,
+			"make sure it matches the filename property of another document",
+		),
+	)
+}
+
+// seriesFunc is a function to be used by templates.
+// It retrieves the series the document is a part of,
+// or nil if it is not part of one.
+//
+//	{{ with series }}
+//	  <a href="{{ .WebPath }}">{{ .Name }}</a>
+//	{{ end }}
+//
+// If a name is given, the series with that name is retrieved instead.
+func (f docFuncs) seriesFunc(name ...string) *series {
+	if f.env.docs == nil {
+		return nil
+	}
+	n := f.meta.Series
+	if len(name) > 0 {
+		n = name[0]
+	}
+	return seriesNamed(
+		f.env.docs.All,
+		n,
+		f.env.cfg.Now(),
+		f.env.cfg != nil && f.env.cfg.Future,
+	)
+}
+
+// seriesIndexFunc is a function to be used by templates.
+// It retrieves the 1-based position of the document in its series,
+// or 0 if it is not part of one.
+func (f docFuncs) seriesIndexFunc() int {
+	return f.seriesFunc().index(f.meta) + 1
+}
+
+// prevPartFunc is a function to be used by templates.
+// It retrieves the part of the document's series that comes before it,
+// or nil if there is none.
+func (f docFuncs) prevPartFunc() Document {
+	sr := f.seriesFunc()
+	if i := sr.index(f.meta); i > 0 {
+		return sr.Parts[i-1]
+	}
+	return nil
+}
+
+// nextPartFunc is a function to be used by templates.
+// It retrieves the part of the document's series that comes after it,
+// or nil if there is none.
+func (f docFuncs) nextPartFunc() Document {
+	sr := f.seriesFunc()
+	if i := sr.index(f.meta); i >= 0 && i < len(sr.Parts)-1 {
+		return sr.Parts[i+1]
+	}
+	return nil
 }
 
 // galleryFunc is a function to be used by templates.
 // It retrieves the slice of images contained in the gallery named by name.
-func (doc *TemplateDocument) galleryFunc(name string) []*img {
-	return doc.photos[name]
+// A pair of dark and light variants is one image,
+// listed as the light variant with its Dark field set.
+func (f docFuncs) galleryFunc(name string) []*img {
+	var ims []*img
+	for _, im := range f.env.galleries[name] {
+		if im.Light != nil {
+			continue
+		}
+		ims = append(ims, im)
+	}
+	return ims
+}
+
+// graphicFunc is a function to be used by templates.
+// It finds the image or video with the given shortname,
+// such as cat for src/img/2023/cat.jpg,
+// building it if it hasn't been built yet.
+func (f docFuncs) graphicFunc(shortname string) (*Graphic, error) {
+	return f.env.graphics.Find(shortname)
 }
 
 // draftsFunc is a function to be used by templates.
 // It retrieves a slice of documents of type draft.
-func (doc *TemplateDocument) draftsFunc() []Document {
-	return doc.documentsOfKind(draft)
+func (f docFuncs) draftsFunc() []Document {
+	return f.documentsOfKind(draft)
 }
 
 // postsFunc is a function to be used by templates.
 // It retrieves a slice of documents of type post.
-func (doc *TemplateDocument) postsFunc() []Document {
-	return doc.documentsOfKind(post)
+func (f docFuncs) postsFunc() []Document {
+	return f.documentsOfKind(post)
 }
 
-func (doc *TemplateDocument) documentsOfKind(k kind) []Document {
-	if doc.docs == nil {
+// documentsOfKind returns the documents of kind k,
+// most recent first.
+// Posts that are scheduled or expired at build time are left out;
+// see [Metadata.ListedAt].
+// Drafts are unpublished by nature,
+// so all of them are listed whatever their dates.
+func (f docFuncs) documentsOfKind(k kind) []Document {
+	if f.env.docs == nil {
 		return nil
 	}
-	docs := &documents{All: make([]Document, 0, len(doc.docs.All))}
-	for _, doc := range doc.docs.All {
-		if doc.Metadata().Kind == k {
-			docs.add(doc)
+	now := f.env.cfg.Now()
+	future := f.env.cfg != nil && f.env.cfg.Future
+	docs := &documents{All: make([]Document, 0, len(f.env.docs.All))}
+	for _, d := range f.env.docs.All {
+		if d.Metadata().Kind != k {
+			continue
+		}
+		if k == draft || d.Metadata().ListedAt(now, future) {
+			docs.add(d)
 		}
 	}
 	sort.Sort(docs)
@@ -271,9 +340,9 @@ func yearly(docs []Document) years {
 	return yrs
 }
 
-// icon returns a function that can be inserted into a template's FuncMap.
-// The returned function renders the image at the given path.
-// It always renders it 1em tall.
+// iconFunc is a function to be used by templates.
+// It renders the image at the given path using the _icon.html.tmpl partial,
+// always 1em tall.
 //
 // Its arguments are a path relative to the web root,
 // followed by an alt text string.
@@ -281,33 +350,22 @@ func yearly(docs []Document) years {
 // For example:
 //
 //	{{ icon "/img/banana.png" "A photo of a banana." }}
-//
-// When called, the returned function renders the image inline.
-func icon(tmplPath string) (iconfunc, error) {
-	iconTmplPath := filepath.Join(tmplPath, iconTmpl)
-	partial, err := os.ReadFile(iconTmplPath)
+func (f docFuncs) iconFunc(src graphic.SRC, alt graphic.Alt) (template.HTML, error) {
+	t, err := f.env.partial(f.meta.TemplateDir, iconTmpl, f.meta, nil)
 	if err != nil {
-		return nil, err
+		return "", fmt.Errorf("cannot load icon template: %w", err)
 	}
-
-	t := template.New(iconTmplPath)
-	if _, err := t.Parse(string(partial)); err != nil {
-		return nil, err
+	v := iconPartialVars{
+		Alt: alt,
+		SRC: src,
 	}
 
-	return func(src graphic.SRC, alt graphic.Alt) (template.HTML, error) {
-		v := iconPartialVars{
-			Alt: alt,
-			SRC: src,
-		}
-
-		var buf bytes.Buffer
-		if err := t.Execute(&buf, v); err != nil {
-			return "", fmt.Errorf("can't execute icon template: %w", err)
-		}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, v); err != nil {
+		return "", fmt.Errorf("can't execute icon template: %w", err)
+	}
 
-		return template.HTML(buf.String()), nil
-	}, nil
+	return template.HTML(buf.String()), nil
 }
 
 type years []*year
@@ -330,23 +388,11 @@ type year struct {
 	Undated   bool
 }
 
-type iconfunc func(graphic.SRC, graphic.Alt) (template.HTML, error)
-
 type iconPartialVars struct {
 	Alt graphic.Alt
 	SRC graphic.SRC
 }
 
-type tocPartialVars struct {
-	Items []tocVars
-}
-
-type tocVars struct {
-	Anchor string
-	Items  []tocVars
-	HTML   template.HTML
-}
-
 func add(a, b int) int {
 	return a + b
 }
@@ -362,41 +408,3 @@ func mul(a, b int) int {
 func sub(a, b int) int {
 	return a - b
 }
-
-// loadDeps searches t and its associated templates for references to other templates,
-// then loads those templates into t.
-// For a template with name n to be loaded, it must reside at the path represented by
-//
-//	filepath.Join(tmplDir, n).
-//
-// For example, if tmplDir is src/templates and t has the following fragment in it,
-// loadDeps will attempt to read, parse, and load src/templates/_foot.html.tmpl into t.
-//
-//	{{ template "_foo.html.tmpl" }}
-//
-// It repeats this recursively until t and all associated templates are fully resolved.
-// No templates are executed.
-func loadDeps(tmplDir string, t *template.Template) error {
-	for _, tmpl := range t.Templates() {
-		for _, node := range tmpl.Tree.Root.Nodes {
-			if node.Type() == parse.NodeTemplate {
-				name := node.(*parse.TemplateNode).Name
-				if name == "body" || t.Lookup(name) != nil {
-					continue
-				}
-				b, err := os.ReadFile(filepath.Join(tmplDir, name))
-				if err != nil {
-					return fmt.Errorf("cannot read template file %q: %w", name, err)
-				}
-				t2, err := tmpl.New(name).Parse(string(b))
-				if err != nil {
-					return err
-				}
-				if err := loadDeps(tmplDir, t2); err != nil {
-					return err
-				}
-			}
-		}
-	}
-	return nil
-}
@@ -40,8 +40,7 @@ func TestTemplate(t *testing.T) {
 			doc := NewTemplateDocument(
 				src,
 				NewMetadata(src, filepath.Join("testdata", "templates")),
-				nil,
-				nil,
+				newTemplates(nil, nil, nil, nil),
 				nil,
 			)
 			if err := doc.Load(strings.NewReader(test.input)); err != nil {
@@ -65,8 +64,7 @@ func TestTemplateDocumentDraftsFunc(t *testing.T) {
 	doc := NewTemplateDocument(
 		"src/test/drafts",
 		NewMetadata("src/test/drafts", filepath.Join("testdata", "templates")),
-		docs,
-		nil,
+		newTemplates(nil, docs, nil, nil),
 		nil,
 	)
 
@@ -76,6 +74,55 @@ func TestTemplateDocumentDraftsFunc(t *testing.T) {
 	assert.Equal(t, got[1].Metadata().Title, "Old Draft")
 }
 
+func TestTemplateDocumentDraftsFuncKeepsScheduledAndExpired(t *testing.T) {
+	at := time.Date(2025, time.June, 1, 0, 0, 0, 0, time.UTC)
+	docs := &documents{}
+	docs.add(testDocument("Scheduled Draft", draft, time.Date(2025, time.July, 1, 0, 0, 0, 0, time.UTC)))
+	expired := testDocument("Expired Draft", draft, time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC))
+	expired.Metadata().ExpiresAt = time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC)
+	docs.add(expired)
+
+	doc := NewTemplateDocument(
+		"src/test/drafts",
+		NewMetadata("src/test/drafts", filepath.Join("testdata", "templates")),
+		newTemplates(&Config{At: at}, docs, nil, nil),
+		nil,
+	)
+
+	got := doc.draftsFunc()
+	assert.Equal(t, len(got), 2)
+	assert.Equal(t, got[0].Metadata().Title, "Scheduled Draft")
+	assert.Equal(t, got[1].Metadata().Title, "Expired Draft")
+}
+
+func TestTemplateDocumentPostsFuncSkipsScheduledAndExpired(t *testing.T) {
+	at := time.Date(2025, time.June, 1, 0, 0, 0, 0, time.UTC)
+	docs := &documents{}
+	docs.add(testDocument("Published", post, time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)))
+	docs.add(testDocument("Scheduled", post, time.Date(2025, time.July, 1, 0, 0, 0, 0, time.UTC)))
+	expired := testDocument("Expired", post, time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC))
+	expired.Metadata().ExpiresAt = time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC)
+	docs.add(expired)
+
+	cfg := &Config{At: at}
+	doc := NewTemplateDocument(
+		"src/test/posts",
+		NewMetadata("src/test/posts", filepath.Join("testdata", "templates")),
+		newTemplates(cfg, docs, nil, nil),
+		nil,
+	)
+
+	got := doc.postsFunc()
+	assert.Equal(t, len(got), 1)
+	assert.Equal(t, got[0].Metadata().Title, "Published")
+
+	cfg.Future = true
+	got = doc.postsFunc()
+	assert.Equal(t, len(got), 2)
+	assert.Equal(t, got[0].Metadata().Title, "Scheduled")
+	assert.Equal(t, got[1].Metadata().Title, "Published")
+}
+
 func TestYearlyGroupsGivenDocuments(t *testing.T) {
 	got := yearly([]Document{
 		testDocument("Draft", draft, time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)),
@@ -0,0 +1,291 @@
+package document // import "twos.dev/winter/document"
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"sync"
+	"text/template/parse"
+)
+
+// templates is the template environment of a substructure,
+// shared by every document it renders.
+//
+// Document bodies, layouts, and partials all see the same functions,
+// bound to the document being rendered;
+// see [docFuncs].
+// Each template file is parsed once,
+// then reused until it changes.
+type templates struct {
+	// cfg holds user preferences, specified by winter.yml.
+	// It may be nil,
+	// in which case defaults are used.
+	cfg *Config
+	// docs is a reference to the substructure's set of docs.
+	// It should be populated fully before any template is executed,
+	// so that templates can use the posts and drafts functions to discover and list docs.
+	docs *documents
+	// galleries is a reference to the substructure's galleries.
+	// It should be populated fully before any template is executed,
+	// so that templates can use the gallery function to discover and list images.
+	galleries map[string][]*img
+	// graphics is a reference to the substructure's graphic finder,
+	// used by the graphic function in templates.
+	// It may be nil,
+	// in which case the graphic function always fails.
+	graphics *Graphics
+
+	mu sync.Mutex
+	// files holds each template file parsed so far.
+	// Templates in it are never executed,
+	// only cloned or copied into the templates that are.
+	files map[templateFile]*template.Template
+}
+
+// templateFile identifies a template file by the name templates refer to it by,
+// such as _icon.html.tmpl,
+// and its path on disk.
+type templateFile struct {
+	name string
+	path string
+}
+
+// newTemplates returns a template environment for templates that use the given pointers to existing configuration,
+// substructure docs, substructure galleries, and substructure graphics.
+// Any of them may be nil.
+func newTemplates(cfg *Config, docs *documents, galleries map[string][]*img, graphics *Graphics) *templates {
+	return &templates{
+		cfg:       cfg,
+		docs:      docs,
+		files:     map[templateFile]*template.Template{},
+		galleries: galleries,
+		graphics:  graphics,
+	}
+}
+
+// funcs returns the functions available to templates rendering the document described by meta.
+// meta may be nil when the functions are not going to be called,
+// such as while parsing.
+func (env *templates) funcs(meta *Metadata) template.FuncMap {
+	return docFuncs{env: env, meta: meta}.funcmap()
+}
+
+// document returns the template for the document described by meta,
+// whose body is body,
+// ready to be executed with meta as its data.
+//
+// If the document has a layout,
+// the body is available to it as the template named body:
+//
+//	{{ template "body" . }}
+//
+// Any templates referenced are looked for by name in the document's template directory,
+// recursively;
+// see [templates.include].
+// The paths of the template files used are returned alongside the template.
+func (env *templates) document(meta *Metadata, body []byte) (*template.Template, []string, error) {
+	files := map[string]struct{}{}
+	var t *template.Template
+	if meta.Layout == "" {
+		var err error
+		t, err = template.New(meta.SourcePath).Funcs(env.funcs(meta)).Parse(string(body))
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot parse template document %q: %w", meta.SourcePath, err)
+		}
+	} else {
+		layout, err := env.file(meta.Layout, meta.Layout)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot load layout for %q: %w", meta.SourcePath, err)
+		}
+		files[meta.Layout] = struct{}{}
+		if t, err = layout.Clone(); err != nil {
+			return nil, nil, fmt.Errorf("cannot clone layout %q for %q: %w", meta.Layout, meta.SourcePath, err)
+		}
+		t.Funcs(env.funcs(meta))
+		if _, err := t.New("body").Parse(string(body)); err != nil {
+			return nil, nil, fmt.Errorf("cannot parse document %q for inclusion in layout %q: %w", meta.SourcePath, meta.Layout, err)
+		}
+	}
+	if err := env.include(meta.TemplateDir, t, files); err != nil {
+		return nil, nil, fmt.Errorf("cannot load dependencies for %q: %w", meta.SourcePath, err)
+	}
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	return t, paths, nil
+}
+
+// partial returns the template file named name in the template directory dir,
+// such as _toc.html.tmpl,
+// ready to be executed on behalf of the document described by meta.
+// Templates it references are looked for in dir as well.
+// If files is not nil,
+// the paths of the file and of the templates it references are added to it.
+func (env *templates) partial(dir, name string, meta *Metadata, files map[string]struct{}) (*template.Template, error) {
+	path := filepath.Join(dir, name)
+	f, err := env.file(name, path)
+	if err != nil {
+		return nil, err
+	}
+	if files != nil {
+		files[path] = struct{}{}
+	}
+	t, err := f.Clone()
+	if err != nil {
+		return nil, fmt.Errorf("cannot clone %s: %w", name, err)
+	}
+	t.Funcs(env.funcs(meta))
+	if err := env.include(dir, t, files); err != nil {
+		return nil, fmt.Errorf("cannot load dependencies for %s: %w", name, err)
+	}
+	return t, nil
+}
+
+// partialOr returns the partial template named name in doc's template directory,
+// such as _callout.html.tmpl,
+// or fallback if the directory has none.
+// The partial and the templates it references are dependencies of doc,
+// as is the partial's path when it doesn't exist yet,
+// so adding or changing them rebuilds doc.
+func (doc *HTMLDocument) partialOr(name string, fallback *template.Template) (*template.Template, error) {
+	path := filepath.Join(doc.meta.TemplateDir, name)
+	doc.deps[path] = struct{}{}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return fallback, nil
+	}
+	tmpl, err := doc.templates().partial(doc.meta.TemplateDir, name, doc.meta, doc.deps)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load %s for %q: %w", name, doc.meta.SourcePath, err)
+	}
+	return tmpl, nil
+}
+
+// file returns the template file at path,
+// named name,
+// parsing it only if it hasn't been parsed since it last changed.
+// The returned template must not be executed;
+// clone it first.
+func (env *templates) file(name, path string) (*template.Template, error) {
+	key := templateFile{name: name, path: filepath.Clean(path)}
+	env.mu.Lock()
+	t, ok := env.files[key]
+	env.mu.Unlock()
+	if ok {
+		return t, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read template file %q: %w", path, err)
+	}
+	t, err = template.New(name).Funcs(env.funcs(nil)).Parse(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse template file %q: %w", path, err)
+	}
+	env.mu.Lock()
+	env.files[key] = t
+	env.mu.Unlock()
+	return t, nil
+}
+
+// include searches t and its associated templates for references to other templates,
+// then adds those templates to t.
+// For a template with name n to be added, it must reside at the path represented by
+//
+//	filepath.Join(dir, n).
+//
+// For example, if dir is src/templates and t has the following fragment in it,
+// include adds src/templates/_foo.html.tmpl to t.
+//
+//	{{ template "_foo.html.tmpl" }}
+//
+// It repeats this until t and all associated templates are fully resolved,
+// recording the path of each file it adds in files if files is not nil.
+// References to the template named body are left for layouts to fill.
+// No templates are executed.
+func (env *templates) include(dir string, t *template.Template, files map[string]struct{}) error {
+	for {
+		names := references(t)
+		if len(names) == 0 {
+			return nil
+		}
+		for _, name := range names {
+			path := filepath.Join(dir, name)
+			f, err := env.file(name, path)
+			if err != nil {
+				return err
+			}
+			for _, ft := range f.Templates() {
+				if t.Lookup(ft.Name()) != nil || ft.Tree == nil {
+					continue
+				}
+				if _, err := t.AddParseTree(ft.Name(), ft.Tree.Copy()); err != nil {
+					return fmt.Errorf("cannot add template %q from %q: %w", ft.Name(), path, err)
+				}
+			}
+			if t.Lookup(name) == nil {
+				return fmt.Errorf("template file %q does not define %q", path, name)
+			}
+			if files != nil {
+				files[path] = struct{}{}
+			}
+		}
+	}
+}
+
+// forget drops any parsed copy of the template file at path,
+// so it is parsed again the next time it is used.
+func (env *templates) forget(path string) {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	path = filepath.Clean(path)
+	for key := range env.files {
+		if key.path == path {
+			delete(env.files, key)
+		}
+	}
+}
+
+// references returns the names of the templates that t and its associated templates invoke,
+// but that are not associated with t,
+// in the order they are first invoked.
+// The template named body is never returned.
+func references(t *template.Template) []string {
+	var names []string
+	seen := map[string]struct{}{}
+	var walk func(n parse.Node)
+	walk = func(n parse.Node) {
+		switch n := n.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+		case *parse.IfNode:
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.TemplateNode:
+			if _, ok := seen[n.Name]; ok || n.Name == "body" || t.Lookup(n.Name) != nil {
+				return
+			}
+			seen[n.Name] = struct{}{}
+			names = append(names, n.Name)
+		}
+	}
+	for _, tmpl := range t.Templates() {
+		if tmpl.Tree != nil {
+			walk(tmpl.Tree.Root)
+		}
+	}
+	return names
+}
@@ -0,0 +1,96 @@
+package document // import "twos.dev/winter/document"
+
+import (
+	"bytes"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestTemplatesLayoutFuncs(t *testing.T) {
+	dir := t.TempDir()
+	for name, body := range map[string]string{
+		"layout.html.tmpl": `<title>{{ .Title }}</title>{{ range posts }}{{ template "_item.html.tmpl" . }}{{ end }}{{ icon "/kiln.png" "Kiln" }}<main>{{ template "body" . }}</main>`,
+		"_item.html.tmpl":  `<li>{{ .Metadata.Title }}</li>`,
+		"_icon.html.tmpl":  `<img src="{{ .SRC }}" alt="{{ .Alt }}">`,
+	} {
+		assert.NilError(t, os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644))
+	}
+	docs := &documents{}
+	docs.add(testDocument("Firing", post, time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)))
+	env := newTemplates(nil, docs, nil, nil)
+
+	meta := NewMetadata("src/kiln.html", dir)
+	meta.Layout = filepath.Join(dir, "layout.html.tmpl")
+	doc := NewTemplateDocument(meta.SourcePath, meta, env, nil)
+	assert.NilError(t, doc.Load(strings.NewReader("---\ntitle: Kiln\n---\n{{ range posts }}{{ .Metadata.Title }}{{ end }}")))
+	var got bytes.Buffer
+	assert.NilError(t, doc.Render(&got))
+	assert.Equal(t, got.String(), `<title>Kiln</title><li>Firing</li><img src="/kiln.png" alt="Kiln"><main>Firing</main>`)
+	assert.Assert(t, doc.DependsOn(filepath.Join(dir, "_item.html.tmpl")))
+}
+
+func TestTemplatesCache(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "_note.html.tmpl")
+	assert.NilError(t, os.WriteFile(path, []byte(`old`), 0o644))
+	env := newTemplates(nil, nil, nil, nil)
+	render := func() string {
+		tmpl, err := env.partial(dir, "_note.html.tmpl", NewMetadata("src/note.md", dir), nil)
+		assert.NilError(t, err)
+		var buf bytes.Buffer
+		assert.NilError(t, tmpl.Execute(&buf, nil))
+		return buf.String()
+	}
+
+	assert.Equal(t, render(), "old")
+	assert.NilError(t, os.WriteFile(path, []byte(`new`), 0o644))
+	assert.Equal(t, render(), "old")
+	env.forget(path)
+	assert.Equal(t, render(), "new")
+}
+
+func TestTemplatesRecursivePartials(t *testing.T) {
+	dir := t.TempDir()
+	for name, body := range map[string]string{
+		"_a.html.tmpl": `a{{ if . }}{{ template "_b.html.tmpl" false }}{{ end }}`,
+		"_b.html.tmpl": `b{{ template "_a.html.tmpl" . }}`,
+	} {
+		assert.NilError(t, os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644))
+	}
+	tmpl, err := newTemplates(nil, nil, nil, nil).partial(dir, "_a.html.tmpl", NewMetadata("src/a.md", dir), nil)
+	assert.NilError(t, err)
+	var buf bytes.Buffer
+	assert.NilError(t, tmpl.Execute(&buf, true))
+	assert.Equal(t, buf.String(), "aba")
+}
+
+func TestPartialOr(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join("src", "test", "page.html")
+	doc := NewHTMLDocument(src, NewMetadata(src, dir), nil, nil)
+	fallback := template.Must(template.New("_box.html.tmpl").Parse(`fallback`))
+	render := func() string {
+		tmpl, err := doc.partialOr("_box.html.tmpl", fallback)
+		assert.NilError(t, err)
+		var buf bytes.Buffer
+		assert.NilError(t, tmpl.Execute(&buf, "kiln"))
+		return buf.String()
+	}
+
+	assert.Equal(t, render(), "fallback")
+	assert.Assert(t, doc.DependsOn(filepath.Join(dir, "_box.html.tmpl")))
+	for name, body := range map[string]string{
+		"_box.html.tmpl":   `<div>{{ template "_label.html.tmpl" . }}</div>`,
+		"_label.html.tmpl": `<b>{{ . }}</b>`,
+	} {
+		assert.NilError(t, os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644))
+	}
+	assert.Equal(t, render(), "<div><b>kiln</b></div>")
+	assert.Assert(t, doc.DependsOn(filepath.Join(dir, "_label.html.tmpl")))
+}
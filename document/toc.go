@@ -0,0 +1,223 @@
+package document // import "twos.dev/winter/document"
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const (
+	// tocMarker is the content of an HTML comment that marks where a table of contents goes,
+	// as in <!-- toc -->.
+	tocMarker = "toc"
+	// tocTextMarker is a paragraph that marks where a table of contents goes,
+	// for formats that cannot easily contain HTML comments.
+	tocTextMarker = "[[toc]]"
+	tocTmpl       = "_toc.html.tmpl"
+)
+
+// TOCOptions describe a document's table of contents.
+//
+// In frontmatter they are either a boolean,
+//
+//	toc: true
+//
+// or a mapping that also overrides the site's defaults:
+//
+//	toc:
+//	  max: 3
+//	  manual: true
+type TOCOptions struct {
+	// Enabled is whether the document has a table of contents.
+	Enabled bool `yaml:"enabled"`
+	// Min is the level of the highest headings listed,
+	// where 2 means <h2>.
+	// If zero, the site's default is used.
+	Min int `yaml:"min,omitempty"`
+	// Max is the level of the deepest headings listed,
+	// where 2 means <h2>.
+	// If zero, the site's default is used.
+	Max int `yaml:"max,omitempty"`
+	// Manual is a flag that leaves the table of contents out of the document body,
+	// so the layout template can render it from .TOCOptions wherever it likes.
+	// If false, the site's default is used.
+	Manual bool `yaml:"manual,omitempty"`
+
+	// Items are the top-level entries of the table of contents.
+	// They are filled in when the document is loaded.
+	Items []tocVars `yaml:"-"`
+}
+
+// UnmarshalYAML lets a table of contents be given in frontmatter
+// as either a boolean or a mapping.
+// A mapping enables the table of contents unless it says otherwise.
+func (t *TOCOptions) UnmarshalYAML(unmarshal func(any) error) error {
+	var enabled bool
+	if err := unmarshal(&enabled); err == nil {
+		*t = TOCOptions{Enabled: enabled}
+		return nil
+	}
+	type plain TOCOptions
+	p := plain{Enabled: true}
+	if err := unmarshal(&p); err != nil {
+		return err
+	}
+	*t = TOCOptions(p)
+	return nil
+}
+
+// tocVars is an entry in a table of contents.
+type tocVars struct {
+	Anchor string
+	Items  []tocVars
+	HTML   template.HTML
+}
+
+// tocSettings returns the heading levels the document's table of contents should list,
+// and whether it is rendered by the layout instead of inserted into the body,
+// from the document's frontmatter or else the site's configuration.
+func (doc *HTMLDocument) tocSettings() (minLevel, maxLevel int, manual bool) {
+	minLevel, maxLevel, manual = tocMin, tocMax, doc.meta.TOCOptions.Manual
+	if doc.s != nil && doc.s.cfg != nil {
+		cfg := doc.s.cfg.TOC
+		if cfg.Min > 0 {
+			minLevel = cfg.Min
+		}
+		if cfg.Max > 0 {
+			maxLevel = cfg.Max
+		}
+		manual = manual || cfg.Manual
+	}
+	if doc.meta.TOCOptions.Min > 0 {
+		minLevel = doc.meta.TOCOptions.Min
+	}
+	if doc.meta.TOCOptions.Max > 0 {
+		maxLevel = doc.meta.TOCOptions.Max
+	}
+	return minLevel, maxLevel, manual
+}
+
+// insertTOC creates a table of contents for the document,
+// if one was requested via metadata,
+// and stores it in the document's metadata for templates.
+//
+// Unless the table of contents is manual,
+// it is also inserted into the document:
+// in place of a <!-- toc --> or [[toc]] marker if there is one,
+// or else immediately before the first heading it lists.
+// A document with no headings to list gets no table of contents.
+func (doc *HTMLDocument) insertTOC() error {
+	doc.meta.TOC = doc.meta.TOCOptions.Enabled
+	doc.meta.TOCOptions.Items = nil
+	marker := findTOCMarker(doc.root)
+	if marker != nil {
+		defer marker.Parent.RemoveChild(marker)
+	}
+	if !doc.meta.TOCOptions.Enabled {
+		return nil
+	}
+
+	minLevel, maxLevel, manual := doc.tocSettings()
+	var first *html.Node
+	for _, n := range allOfTypes(doc.root, map[atom.Atom]struct{}{
+		atom.H1: {},
+		atom.H2: {},
+		atom.H3: {},
+		atom.H4: {},
+		atom.H5: {},
+		atom.H6: {},
+	}) {
+		level := hi[n.DataAtom]
+		if level < minLevel || level > maxLevel {
+			continue
+		}
+		if first == nil {
+			first = n
+		}
+		grp := &doc.meta.TOCOptions.Items
+		for i := minLevel; i < level; i++ {
+			if len(*grp) > 0 {
+				grp = &((*grp)[len(*grp)-1].Items)
+			}
+		}
+		// Replace the <h*> tag with a <span>
+		wrapper := &html.Node{
+			Data:     atom.Span.String(),
+			DataAtom: atom.Span,
+			Type:     html.ElementNode,
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			wrapper.AppendChild(deepCopy(child))
+		}
+		var buf bytes.Buffer
+		if err := html.Render(&buf, wrapper); err != nil {
+			return err
+		}
+		*grp = append(*grp, tocVars{
+			Anchor: attr(n, atom.Id),
+			HTML:   template.HTML(buf.String()),
+		})
+	}
+	if first == nil {
+		slog.Debug(fmt.Sprintf("No headings for a table of contents in %s.", doc.meta.SourcePath))
+		return nil
+	}
+	if manual {
+		return nil
+	}
+
+	toctmpl, err := doc.parseTOCTemplates()
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := toctmpl.Execute(&buf, doc.meta.TOCOptions); err != nil {
+		return err
+	}
+
+	at := first
+	if marker != nil {
+		at = marker
+	}
+	toc, err := html.ParseFragment(&buf, at.Parent)
+	if err != nil {
+		return err
+	}
+	for _, n := range toc {
+		at.Parent.InsertBefore(n, at)
+	}
+	return nil
+}
+
+// parseTOCTemplates returns the template for a table of contents,
+// which includes the template for the nested tables of subsections.
+func (doc *HTMLDocument) parseTOCTemplates() (*template.Template, error) {
+	toctmpl, err := doc.templates().partial(doc.meta.TemplateDir, tocTmpl, doc.meta, doc.deps)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load toc for %q: %w", doc.meta.SourcePath, err)
+	}
+	return toctmpl, nil
+}
+
+// findTOCMarker returns the first <!-- toc --> comment in n,
+// or the first paragraph consisting only of [[toc]].
+// If there is neither, it returns nil.
+func findTOCMarker(n *html.Node) *html.Node {
+	if n.Type == html.CommentNode && strings.EqualFold(strings.TrimSpace(n.Data), tocMarker) {
+		return n
+	}
+	if n.DataAtom == atom.P && strings.TrimSpace(text(n)) == tocTextMarker {
+		return n
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if marker := findTOCMarker(child); marker != nil {
+			return marker
+		}
+	}
+	return nil
+}
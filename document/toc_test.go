@@ -0,0 +1,128 @@
+package document // import "twos.dev/winter/document"
+
+import (
+	"bytes"
+	"html/template"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestHTMLTOC(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		input    string
+		expected string
+		anchors  []string
+		absent   []string
+	}{
+		{
+			name:     "BeforeFirstHeading",
+			input:    "---\ntoc: true\n---\n<p>Intro</p><h2>Fire</h2><h3>Heat</h3><h2>Ash</h2>",
+			expected: `<p>Intro</p><ol id="toc">`,
+			anchors:  []string{"fire", "heat", "ash"},
+		},
+		{
+			name:     "CommentMarker",
+			input:    "---\ntoc: true\n---\n<p>Intro</p><h2>Fire</h2><!-- toc --><p>Body</p>",
+			expected: `</h2><ol id="toc">`,
+			anchors:  []string{"fire"},
+		},
+		{
+			name:     "TextMarker",
+			input:    "---\ntoc: true\n---\n<p>Intro</p><p>[[toc]]</p><h2>Fire</h2>",
+			expected: `<p>Intro</p><ol id="toc">`,
+			anchors:  []string{"fire"},
+		},
+		{
+			name:     "Depth",
+			input:    "---\ntoc:\n  max: 2\n---\n<h2>Fire</h2><h3>Heat</h3>",
+			expected: `<ol id="toc">`,
+			anchors:  []string{"fire"},
+			absent:   []string{"heat"},
+		},
+		{
+			name:     "NoH2",
+			input:    "---\ntoc: true\n---\n<p>Intro</p><h3>Heat</h3>",
+			expected: `<p>Intro</p><ol id="toc">`,
+			anchors:  []string{"heat"},
+		},
+		{
+			name:  "NoHeadings",
+			input: "---\ntoc: true\n---\n<p>Intro</p>",
+		},
+		{
+			name:   "Manual",
+			input:  "---\ntoc:\n  manual: true\n---\n<h2>Fire</h2>",
+			absent: []string{"fire"},
+		},
+		{
+			name:  "Disabled",
+			input: "<p>Intro</p><!-- toc --><h2>Fire</h2>",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			src := "src/test/" + test.name
+			doc := NewHTMLDocument(
+				src,
+				NewMetadata(src, filepath.Join("testdata", "templates")),
+				nil,
+				nil,
+			)
+			assert.NilError(t, doc.Load(strings.NewReader(test.input)))
+			var buf bytes.Buffer
+			assert.NilError(t, doc.Render(&buf))
+			actual := regexp.MustCompile(`>\s+<`).ReplaceAllString(buf.String(), "><")
+
+			assert.Assert(t, !strings.Contains(actual, "toc --") && !strings.Contains(actual, "[[toc]]"), actual)
+			if test.expected == "" {
+				assert.Assert(t, !strings.Contains(actual, `<ol id="toc">`), actual)
+			} else {
+				assert.Assert(t, strings.Contains(actual, test.expected), actual)
+			}
+			for _, anchor := range test.anchors {
+				assert.Assert(t, strings.Contains(actual, `<li><a href="#`+anchor+`">`), actual)
+			}
+			for _, anchor := range test.absent {
+				assert.Assert(t, !strings.Contains(actual, `<li><a href="#`+anchor+`">`), actual)
+			}
+		})
+	}
+}
+
+func TestHTMLManualTOCItems(t *testing.T) {
+	src := "src/test/ManualTOCItems"
+	doc := NewHTMLDocument(
+		src,
+		NewMetadata(src, filepath.Join("testdata", "templates")),
+		nil,
+		nil,
+	)
+	assert.NilError(t, doc.Load(strings.NewReader("---\ntoc:\n  manual: true\n---\n<h2>Fire</h2><h3>Heat</h3><h2>Ash</h2>")))
+	assert.Assert(t, doc.Metadata().TOC)
+	toc := doc.Metadata().TOCOptions
+	assert.Equal(t, len(toc.Items), 2)
+	assert.Equal(t, toc.Items[0].Anchor, "fire")
+	assert.Equal(t, len(toc.Items[0].Items), 1)
+	assert.Equal(t, toc.Items[0].Items[0].Anchor, "heat")
+	assert.Equal(t, toc.Items[1].Anchor, "ash")
+}
+
+func TestHTMLTOCTruthiness(t *testing.T) {
+	for input, want := range map[string]string{
+		"<h2>Fire</h2>":                           "no",
+		"---\ntoc: true\n---\n<h2>Fire</h2>":      "yes",
+		"---\ntoc:\n  max: 3\n---\n<h2>Fire</h2>": "yes",
+	} {
+		src := "src/test/TOCTruthiness"
+		meta := NewMetadata(src, filepath.Join("testdata", "templates"))
+		assert.NilError(t, NewHTMLDocument(src, meta, nil, nil).Load(strings.NewReader(input)))
+		var buf strings.Builder
+		tmpl := template.Must(template.New("layout").Parse(`{{ if .TOC }}yes{{ else }}no{{ end }}`))
+		assert.NilError(t, tmpl.Execute(&buf, meta))
+		assert.Equal(t, buf.String(), want, input)
+	}
+}
@@ -1,6 +1,11 @@
 package document // import "twos.dev/winter/document"
 
-import "strings"
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
 
 // newPadder returns a function that pads, with spaces, the ends of strings given to it.
 // The padding is enough to make it the length of the longest string seen so far.
@@ -24,3 +29,43 @@ func newPadder() func(string) string {
 		return s + strings.Repeat(" ", longest-len(s))
 	}
 }
+
+// slugify converts s into a lowercase string of letters and digits separated by single hyphens,
+// suitable for use in a web path.
+//
+// For example, "Building a Kiln, Part 1" becomes "building-a-kiln-part-1".
+func slugify(s string) string {
+	return SlugRules{}.slugify(s)
+}
+
+// slugify converts s into a slug according to rules.
+// See [SlugRules] for details.
+func (rules SlugRules) slugify(s string) string {
+	sepr := rules.Separator
+	if sepr == "" {
+		sepr = "-"
+	}
+	if !rules.KeepCase {
+		s = strings.ToLower(s)
+	}
+	if rules.ASCII {
+		s = norm.NFD.String(s)
+	}
+	var b strings.Builder
+	sep := false
+	for _, r := range s {
+		if rules.ASCII && unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) || rules.ASCII && r > unicode.MaxASCII {
+			sep = true
+			continue
+		}
+		if sep && b.Len() > 0 {
+			b.WriteString(sepr)
+		}
+		sep = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -47,7 +47,7 @@
 // # Galleries
 //
 // A block containing only images is treated as a gallery,
-// with the images placed in a responsive grid.
+// with the images placed in a <figure class="gallery"> that can be styled as a responsive grid.
 // Images can be clicked to zoom in or out.
 //
 //	![An image of a cat.](/img/cat.jpg)
@@ -56,7 +56,8 @@
 // # Image captions
 //
 // A block of all-italic text immediately below an image or gallery is treated as a caption,
-// and given a special visual treatment and accessibility structure.
+// and given a special visual treatment and accessibility structure
+// by becoming the <figcaption> of the image's <figure>.
 //
 //	![An image of a cat.](/img/cat.jpg)
 //	![An image of a dog.](/img/dog.jpg)
@@ -87,6 +88,10 @@
 //
 //	$\LaTeX$ users rejoice!
 //
+// If math.render is set in winter.yml,
+// LaTeX is instead rendered into MathML at build time,
+// so it displays without JavaScript.
+//
 // # Tables of contents
 //
 // A table of contents can be requested by setting the toc variable to true in frontmatter.
@@ -119,6 +124,20 @@
 //	}
 //	```
 //
+// # Diagrams
+//
+// Fenced code blocks in a language with a configured renderer,
+// such as dot or mermaid,
+// are rendered into inline SVG at build time.
+// The source is kept in a collapsed <details> element beneath.
+//
+// # Other formats
+//
+// Besides Markdown, Org, AsciiDoc, Jupyter notebooks, and HTML,
+// Winter builds any source format registered from Go with [RegisterFormat].
+// A format names its file extensions
+// and turns each source file into HTML that Winter then treats like any other page.
+//
 // # External links in new tabs
 //
 // Any links that navigate to external websites will automatically have a target=_blank set during generation.
@@ -128,6 +147,7 @@
 // If an image's extensionless filename ends in "-dark" or "-light",
 // and another image exists at the same path but with the opposite suffix,
 // the correct one will be rendered to the user based on their light-/dark-mode preference.
+// Referencing either one renders a <picture> with a prefers-color-scheme source for the dark variant.
 //
 // [<img srcset>]: https://developer.mozilla.org/en-US/docs/Learn/HTML/Multimedia_and_embedding/Responsive_images
 // [Cool URIs don't change.]: https://www.w3.org/Provider/Style/URI
@@ -137,6 +157,7 @@ package document // import "twos.dev/winter/document"
 
 import (
 	"fmt"
+	"io/fs"
 	"log/slog"
 	"net/url"
 	"os"
@@ -146,12 +167,15 @@ import (
 	"strings"
 
 	"github.com/yargevad/filepathx"
+	"twos.dev/winter/graphic"
 )
 
 const (
 	AppName = "winter"
 
+	asciiDocSuffix = ".adoc"
 	htmlSuffix     = ".html"
+	jupyterSuffix  = ".ipynb"
 	markdownSuffix = ".md"
 	orgSuffix      = ".org"
 	templateSuffix = ".html.tmpl"
@@ -208,6 +232,17 @@ type Substructure struct {
 	docs *documents
 	// galleries is a map of gallery name to slice of galleries in that gallery.
 	galleries map[string][]*img
+	// graphics finds images and videos by shortname for templates.
+	graphics *Graphics
+	// links records which documents link to which other documents.
+	links linkGraph
+	// splits holds the source paths of the documents in each source file split into several,
+	// in the order they appear in the file,
+	// by the cleaned path of the file.
+	splits map[string][]string
+	// templates parses the templates documents are rendered with,
+	// and gives them their functions.
+	templates *templates
 }
 
 // NewSubstructure returns a substructure with the given configuration.
@@ -222,12 +257,15 @@ func NewSubstructure(cfg *Config) (*Substructure, error) {
 			err,
 		)
 	}
-	s := Substructure{
-		cfg:    cfg,
-		devURL: devURL,
-		docs:   &documents{},
+	s := &Substructure{
+		cfg:       cfg,
+		devURL:    devURL,
+		docs:      &documents{},
+		galleries: map[string][]*img{},
 	}
-	return &s, s.discover()
+	s.graphics = &Graphics{s: s}
+	s.templates = newTemplates(cfg, s.docs, s.galleries, s.graphics)
+	return s, s.discover()
 }
 
 // DocumentCount returns the number of documents known to the substructure.
@@ -248,36 +286,122 @@ func (s *Substructure) ImageCount() int {
 }
 
 // Build builds doc.
+// Any previously built documents whose backlinks changed as a result are written again.
 //
 // To also build downstream dependencies, use [Rebuild] instead.
 func (s *Substructure) Build(doc Document) error {
-	r, err := os.Open(doc.Metadata().SourcePath)
+	if err := s.load(doc); err != nil {
+		return err
+	}
+	if doc.Metadata().links != nil {
+		for _, target := range s.updateLinks(doc) {
+			if err := s.write(target); err != nil {
+				return fmt.Errorf(
+					"cannot refresh backlinks of %q (linked from %q): %w",
+					target.Metadata().SourcePath,
+					doc.Metadata().SourcePath,
+					err,
+				)
+			}
+		}
+	}
+	return s.write(doc)
+}
+
+// load reads doc's source file into doc.
+func (s *Substructure) load(doc Document) error {
+	src := doc.Metadata().SourcePath
+	f, err := os.Open(sourceFile(src))
 	if err != nil {
 		return fmt.Errorf(
 			"cannot read %q for building %q: %w",
-			doc.Metadata().SourcePath,
+			src,
 			doc.Metadata().Title,
 			err,
 		)
 	}
-	defer r.Close()
-	if err := doc.Load(r); err != nil {
+	if err := doc.Load(f); err != nil {
+		f.Close()
 		return fmt.Errorf(
 			"cannot load %q for building %q: %w",
-			doc.Metadata().SourcePath,
+			src,
 			doc.Metadata().Title,
 			err,
 		)
 	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("cannot close %q after loading it: %w", src, err)
+	}
+	return nil
+}
 
-	if err := s.buildWWW(doc); err != nil {
-		return err
+// loadAll loads every document and records its links in the link graph,
+// then fills in the links and backlinks of each,
+// so a full build knows the backlinks of every document before it writes any of them.
+func (s *Substructure) loadAll() error {
+	for _, doc := range s.docs.All {
+		slog.Debug(fmt.Sprintf("%s ↓", doc.Metadata().SourcePath))
+		if err := s.load(doc); err != nil {
+			return err
+		}
+		if meta := doc.Metadata(); meta.links != nil {
+			s.links.set(meta.WebPath, meta.links)
+		}
 	}
-	if err := s.buildGemini(doc); err != nil {
+	for _, doc := range s.docs.All {
+		if doc.Metadata().links != nil {
+			s.updateLinks(doc)
+		}
+	}
+	return nil
+}
+
+// write renders the loaded doc into its web and Gemini files.
+func (s *Substructure) write(doc Document) error {
+	if err := s.buildWWW(doc); err != nil {
 		return err
 	}
+	return s.buildGemini(doc)
+}
 
-	return nil
+// buildDocs builds every document known to the substructure,
+// and returns them by web path.
+//
+// Every document is loaded once,
+// before any is written,
+// so each knows its backlinks and the metadata of any documents it lists.
+func (s *Substructure) buildDocs() (map[string]Document, error) {
+	if err := s.loadAll(); err != nil {
+		return nil, fmt.Errorf("cannot load documents: %w", err)
+	}
+	// Series are validated before anything is written,
+	// so an invalid series doesn't leave a half-updated site behind.
+	if err := s.validateSeries(); err != nil {
+		return nil, err
+	}
+	built := map[string]Document{}
+	for _, doc := range s.docs.All {
+		if prev, ok := built[doc.Metadata().WebPath]; ok {
+			return nil, fmt.Errorf(
+				"both %s (%T) and %s (%T) wanted to build to %s/%s; remove one",
+				doc.Metadata().SourcePath,
+				doc,
+				prev.Metadata().SourcePath,
+				prev,
+				s.cfg.Production.URL,
+				doc.Metadata().WebPath,
+			)
+		}
+		if err := s.write(doc); err != nil {
+			return nil, fmt.Errorf(
+				"cannot build %q during ExecuteAll: %w",
+				doc.Metadata().SourcePath,
+				err,
+			)
+		}
+		built[doc.Metadata().WebPath] = doc
+	}
+	return built, nil
 }
 
 func (s *Substructure) buildWWW(doc Document) error {
@@ -359,6 +483,7 @@ func (s *Substructure) DocBySourcePath(path string) (doc Document, ok bool) {
 // ExecuteAll builds all documents known to the substructure,
 // as well as any site-scoped non-documents such as RSS feeds.
 func (s *Substructure) ExecuteAll(dist string) error {
+	s.graphics.forget("")
 	builtIMGs := map[string]*img{}
 	for _, gallery := range s.galleries {
 		for _, im := range gallery {
@@ -374,122 +499,133 @@ func (s *Substructure) ExecuteAll(dist string) error {
 					im.WebPath,
 				)
 			}
-			fresh, err := im.generatedPhotosAreFresh(im.SourcePath)
-			if err != nil {
-				return fmt.Errorf(
-					"cannot check freshness of %q: %w",
-					im.SourcePath,
-					err,
-				)
-			}
-			// If the source is fresh but the target file doesn't exist in dist,
-			// we still need to (re)generate it. Only skip when both are true:
-			// cache says it's fresh AND it actually exists.
-			// (e.g. the user may `rm -rf dist/`.)
-			if fresh {
-				dest := filepath.Join(dist, im.WebPath)
-				if _, statErr := os.Stat(dest); statErr == nil {
-					if err := im.loadMetadataFromSource(); err != nil {
-						return wrapErrorf(
-							err,
-							"cannot load metadata for %q",
-							im.SourcePath,
-						)
-					}
-					if err := im.loadThumbnailMetadata(); err != nil {
-						return fmt.Errorf("cannot load thumbnails for %q: %w", im.SourcePath, err)
-					}
-					builtIMGs[im.WebPath] = im
-					continue
-				}
-			}
-			srcf, err := os.Open(im.SourcePath)
-			if err != nil {
-				return fmt.Errorf("cannot open image: %w", err)
-			}
-			defer srcf.Close()
-			dest := filepath.Join(dist, im.WebPath)
-			if err := im.Load(srcf); err != nil {
-				return wrapErrorf(err, "cannot load image")
-			}
-			if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
-				return fmt.Errorf(
-					"cannot make gallery dir %q: %w",
-					filepath.Dir(dest),
-					err,
-				)
-			}
-			destf, err := os.Create(dest)
-			if err != nil {
-				return fmt.Errorf(
-					"cannot write image %q to %q during ExecuteAll: %w",
-					im.SourcePath,
-					dest,
-					err,
-				)
-			}
-			defer destf.Close()
-			if err := im.Render(destf); err != nil {
+			// Documents that show the image are built below with the rest.
+			if _, err := s.buildIMG(im, dist); err != nil {
 				return err
 			}
-			if err := s.Rebuild(im.SourcePath); err != nil {
-				return fmt.Errorf(
-					"cannot rebuild image %q during ExecuteAll: %w",
-					im.SourcePath,
-					err,
-				)
-			}
 			builtIMGs[im.WebPath] = im
 		}
 	}
-	builtDocs := map[string]Document{}
-	for _, doc := range s.docs.All {
-		if prev, ok := builtDocs[doc.Metadata().WebPath]; ok {
-			return fmt.Errorf(
-				"both %s (%T) and %s (%T) wanted to build to %s/%s; remove one",
-				doc.Metadata().SourcePath,
-				doc,
-				prev.Metadata().SourcePath,
-				prev,
-				s.cfg.Production.URL,
-				doc.Metadata().WebPath,
-			)
-		}
-		if err := s.Rebuild(doc.Metadata().SourcePath); err != nil {
-			return fmt.Errorf(
-				"cannot rebuild %q during ExecuteAll: %w",
-				doc.Metadata().SourcePath,
-				err,
-			)
-		}
-		builtDocs[doc.Metadata().WebPath] = doc
+	builtDocs, err := s.buildDocs()
+	if err != nil {
+		return err
+	}
+	if err := s.writeSeries(builtDocs); err != nil {
+		return fmt.Errorf("cannot generate series overviews: %w", err)
 	}
-
 	if err := s.writefeed(); err != nil {
 		return fmt.Errorf("cannot generate feed: %w", err)
 	}
+	if err := s.writeGraph(dist); err != nil {
+		return fmt.Errorf("cannot generate link graph: %w", err)
+	}
 
 	return s.validateURIsDidNotChange(dist)
 }
 
+// buildIMG generates im and its thumbnails in dist,
+// and reports whether it did.
+// If they were generated from the same source before and still exist,
+// only their metadata is loaded.
+func (s *Substructure) buildIMG(im *img, dist string) (bool, error) {
+	fresh, err := im.generatedPhotosAreFresh(im.SourcePath)
+	if err != nil {
+		return false, fmt.Errorf(
+			"cannot check freshness of %q: %w",
+			im.SourcePath,
+			err,
+		)
+	}
+	dest := filepath.Join(dist, im.WebPath)
+	// If the source is fresh but the target file doesn't exist in dist,
+	// we still need to (re)generate it. Only skip when both are true:
+	// cache says it's fresh AND it actually exists.
+	// (e.g. the user may `rm -rf dist/`.)
+	if fresh {
+		if _, statErr := os.Stat(dest); statErr == nil {
+			if err := im.loadMetadataFromSource(); err != nil {
+				return false, wrapErrorf(
+					err,
+					"cannot load metadata for %q",
+					im.SourcePath,
+				)
+			}
+			if err := im.loadThumbnailMetadata(); err != nil {
+				return false, fmt.Errorf("cannot load thumbnails for %q: %w", im.SourcePath, err)
+			}
+			return false, nil
+		}
+	}
+	srcf, err := os.Open(im.SourcePath)
+	if err != nil {
+		return false, fmt.Errorf("cannot open image: %w", err)
+	}
+	defer srcf.Close()
+	if err := im.Load(srcf); err != nil {
+		return false, wrapErrorf(err, "cannot load image")
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return false, fmt.Errorf(
+			"cannot make gallery dir %q: %w",
+			filepath.Dir(dest),
+			err,
+		)
+	}
+	destf, err := os.Create(dest)
+	if err != nil {
+		return false, fmt.Errorf(
+			"cannot write image %q to %q: %w",
+			im.SourcePath,
+			dest,
+			err,
+		)
+	}
+	defer destf.Close()
+	if err := im.Render(destf); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // Rebuild rebuilds the document or template at the given path.
 // Then, it rebuilds any downstream dependencies.
 //
 // If src isn't known to the substructure, Rebuild no-ops and returns no error.
 func (s *Substructure) Rebuild(src string) error {
 	slog.Debug(fmt.Sprintf("%s ↓", src))
+	if s.templates != nil {
+		s.templates.forget(src)
+	}
+	s.graphics.forget(src)
+	if err := s.resplit(src); err != nil {
+		return fmt.Errorf("cannot update documents in %q: %w", src, err)
+	}
 	if doc, ok := s.DocBySourcePath(src); ok {
 		if err := s.Build(doc); err != nil {
 			return fmt.Errorf("cannot retrieve doc at %q: %w", src, err)
 		}
+	} else if _, ok := s.splits[filepath.Clean(src)]; ok {
+		slog.Debug("  + Building the documents in it.")
 	} else {
 		slog.Debug("  + Tracking new file.")
+		before := map[string]int{}
+		for name, gallery := range s.galleries {
+			before[name] = len(gallery)
+		}
 		if err := s.discoverAtPath(src); err != nil {
 			return fmt.Errorf("cannot add document to in-flight substructure: %w", err)
 		}
+		var added []*img
+		for name, gallery := range s.galleries {
+			if len(gallery) != before[name] {
+				added = append(added, gallery...)
+			}
+		}
+		s.pairVariants(added)
 	}
 	for _, doc := range s.docs.All {
-		if doc.DependsOn(src) && doc.Metadata().SourcePath != src {
+		if doc.DependsOn(src) && doc.Metadata().SourcePath != src ||
+			s.isSeriesSibling(doc, src) {
 			if err := s.Build(doc); err != nil {
 				return fmt.Errorf(
 					"cannot build %q (dependent of %q): %w",
@@ -533,6 +669,11 @@ func (s *Substructure) discover() error {
 			return err
 		}
 	}
+	var ims []*img
+	for _, gallery := range s.galleries {
+		ims = append(ims, gallery...)
+	}
+	s.pairVariants(ims)
 	if err := s.discoverStatic("public"); err != nil {
 		return err
 	}
@@ -544,21 +685,7 @@ func (s *Substructure) discoverAtPath(path string) error {
 	if err := s.discoverGalleries(path); err != nil {
 		return err
 	}
-	if err := s.discoverHTML(path); err != nil {
-		return err
-	}
-	if err := s.discoverMarkdown(path); err != nil {
-		return err
-	}
-	if err := s.discoverOrg(path); err != nil {
-		return err
-	}
-	// TODO: Calling discoverTemplates once misses *.html.tmpl files.
-	// Calling it twice doesn't. Fix?
-	if err := s.discoverTemplates(path); err != nil {
-		return err
-	}
-	if err := s.discoverTemplates(path); err != nil {
+	if err := s.discoverDocuments(path); err != nil {
 		return err
 	}
 	sort.Sort(s.docs)
@@ -578,7 +705,7 @@ func (s *Substructure) discoverGalleries(src string) error {
 	sort.Sort(sort.Reverse((sort.StringSlice(files))))
 	for _, src := range files {
 		if shouldIgnore(src) {
-			return nil
+			continue
 		}
 		slog.Debug(fmt.Sprintf("+ %s", src))
 		im, err := NewIMG(src, s.cfg)
@@ -593,36 +720,82 @@ func (s *Substructure) discoverGalleries(src string) error {
 	return nil
 }
 
-// discoverHTML adds all *.html documents in or at the given path glob to the substructure.
-func (s *Substructure) discoverHTML(path string) error {
-	var htmlFiles []string
+// pairVariants links each of ims that is a dark or light variant of a known image,
+// such as cat-dark.jpg,
+// with its partner,
+// such as cat-light.jpg,
+// and warns about any that have no partner.
+// Partners can be in different source directories,
+// so it runs once all of them have been discovered,
+// and again only for the galleries of images discovered later.
+func (s *Substructure) pairVariants(ims []*img) {
+	sort.Slice(ims, func(i, j int) bool { return ims[i].SourcePath < ims[j].SourcePath })
+	for _, im := range ims {
+		partnerPath, dark, ok := graphic.Partner(graphic.SRC(filepath.ToSlash(im.WebPath)))
+		if !ok {
+			continue
+		}
+		partner, ok := s.imgByRef(string(partnerPath))
+		if !ok {
+			scheme := "dark"
+			if dark {
+				scheme = "light"
+			}
+			slog.Warn(fmt.Sprintf("%s has no %s variant; expected one to build to %s.", im.SourcePath, scheme, partnerPath))
+			continue
+		}
+		if dark {
+			im.Light, partner.Dark = partner, im
+		} else {
+			im.Dark, partner.Light = partner, im
+		}
+	}
+}
+
+// discoverDocuments adds all documents in or at the given path glob
+// that are in a registered [Format] to the substructure.
+func (s *Substructure) discoverDocuments(path string) error {
+	// TODO: Allow looking in user's org directory.
+	var files []string
 	if stat, err := os.Stat(path); err != nil {
 		if !os.IsNotExist(err) {
 			return err
 		}
 	} else if stat.IsDir() {
-		htmlf, err := filepathx.Glob(filepath.Join(path, "**", fmt.Sprintf("*%s", htmlSuffix)))
+		// Walk once and skip directories by their entries,
+		// so only files in a registered format are looked at further.
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() {
+				files = append(files, p)
+			}
+			return nil
+		})
 		if err != nil {
 			return err
 		}
-		htmlFiles = append(htmlFiles, htmlf...)
-	} else if strings.HasSuffix(path, htmlSuffix) {
-		htmlFiles = append(htmlFiles, path)
 	} else {
-		return nil
+		files = append(files, path)
 	}
 
-	for _, src := range htmlFiles {
+	for _, src := range files {
 		if shouldIgnore(src) {
 			continue
 		}
-		slog.Debug(fmt.Sprintf("+ %s", src))
-		meta := NewMetadata(src, tmplPath)
-		s.add(
-			NewHTMLDocument(src, meta,
-				NewTemplateDocument(src, meta, s.docs, s.galleries, nil),
-			),
-		)
+		f, ok := formatOf(src)
+		if !ok {
+			continue
+		}
+		srcs, err := s.split(f, src)
+		if err != nil {
+			return err
+		}
+		for _, src := range srcs {
+			slog.Debug(fmt.Sprintf("+ %s", src))
+			s.add(s.newDocument(f, src))
+		}
 	}
 	for _, d := range s.docs.All {
 		if p, _, ok := strings.Cut(d.Metadata().WebPath, "_"); ok {
@@ -636,76 +809,84 @@ func (s *Substructure) discoverHTML(path string) error {
 	return nil
 }
 
-// discoverMarkdown adds all *.md documents in or at the given path glob to the substructure.
-func (s *Substructure) discoverMarkdown(path string) error {
-	var mdFiles []string
-	if stat, err := os.Stat(path); err != nil {
-		if !os.IsNotExist(err) {
-			return err
-		}
-	} else if stat.IsDir() {
-		mdFiles, err = filepathx.Glob(filepath.Join(path, "**", fmt.Sprintf("*%s", markdownSuffix)))
-		if err != nil {
-			return err
-		}
-	} else if strings.HasSuffix(path, markdownSuffix) {
-		mdFiles = append(mdFiles, path)
+// newDocument returns a document for src,
+// which is in the format f.
+func (s *Substructure) newDocument(f Format, src string) Document {
+	meta := NewMetadata(src, tmplPath)
+	doc := f.New(src, meta,
+		NewHTMLDocument(src, meta, s,
+			NewTemplateDocument(src, meta, s.templates, nil),
+		),
+	)
+	if _, ok := doc.(GeminiRenderer); !ok {
+		// There is nothing to write to a Gemini file.
+		meta.GeminiPath = ""
 	}
+	return doc
+}
 
-	for _, src := range mdFiles {
-		if shouldIgnore(src) {
-			continue
-		}
-		slog.Debug(fmt.Sprintf("+ %s", src))
-		meta := NewMetadata(src, tmplPath)
-		s.add(
-			NewMarkdownDocument(src, meta,
-				map[Document]struct{}{
-					NewHTMLDocument(src, meta,
-						NewTemplateDocument(src, meta, s.docs, s.galleries, nil),
-					): {},
-					NewGeminiDocument(src, meta): {},
-				},
-			),
-		)
+// split returns the source paths of the documents in the source file at src,
+// which is in the format f,
+// and remembers them if there are several.
+func (s *Substructure) split(f Format, src string) ([]string, error) {
+	if s.splits == nil {
+		s.splits = map[string][]string{}
 	}
-
-	return nil
+	delete(s.splits, filepath.Clean(src))
+	if f.Split == nil {
+		return []string{src}, nil
+	}
+	srcs, err := f.Split(src)
+	if err != nil {
+		return nil, err
+	}
+	if len(srcs) == 0 {
+		return []string{src}, nil
+	}
+	s.splits[filepath.Clean(src)] = srcs
+	return srcs, nil
 }
 
-// discoverOrg adds all *.org documents in or at the given path glob to the substructure.
-func (s *Substructure) discoverOrg(path string) error {
-	// TODO: Allow looking in user's org directory.
-	// TODO: Allow rendering only a subsection of an org file.
-	var orgFiles []string
-	if stat, err := os.Stat(path); err != nil {
-		if !os.IsNotExist(err) {
-			return err
-		}
-	} else if stat.IsDir() {
-		orgFiles, err = filepathx.Glob(filepath.Join(path, "**", fmt.Sprintf("*%s", orgSuffix)))
-		if err != nil {
-			return err
+// resplit brings the documents of the source file at src up to date with the file,
+// for formats in which one file can hold several documents.
+// Documents no longer in the file are dropped,
+// and documents new to it are added.
+func (s *Substructure) resplit(src string) error {
+	f, ok := formatOf(src)
+	if !ok || f.Split == nil {
+		return nil
+	}
+	if stat, err := os.Stat(src); err != nil || stat.IsDir() {
+		return nil
+	}
+	srcs, err := s.split(f, src)
+	if err != nil {
+		return err
+	}
+	added := map[string]struct{}{}
+	for _, p := range srcs {
+		added[p] = struct{}{}
+	}
+	kept := make([]Document, 0, len(s.docs.All))
+	for _, doc := range s.docs.All {
+		p := doc.Metadata().SourcePath
+		if filepath.Clean(sourceFile(p)) == filepath.Clean(src) {
+			if _, ok := added[p]; !ok {
+				slog.Debug(fmt.Sprintf("- %s", p))
+				continue
+			}
+			delete(added, p)
 		}
-	} else if strings.HasSuffix(path, orgSuffix) {
-		orgFiles = append(orgFiles, path)
+		kept = append(kept, doc)
 	}
-
-	for _, src := range orgFiles {
-		if shouldIgnore(src) {
-			continue
+	s.docs.All = kept
+	for _, p := range srcs {
+		if _, ok := added[p]; ok {
+			slog.Debug(fmt.Sprintf("+ %s", p))
+			s.add(s.newDocument(f, p))
 		}
-		slog.Debug(fmt.Sprintf("+ %s", src))
-		meta := NewMetadata(src, tmplPath)
-		s.add(
-			NewOrgDocument(src, meta,
-				NewHTMLDocument(src, meta,
-					NewTemplateDocument(src, meta, s.docs, s.galleries, nil),
-				),
-			),
-		)
 	}
-
+	sort.Sort(s.docs)
 	return nil
 }
 
@@ -755,47 +936,6 @@ func (s *Substructure) discoverStatic(path string) error {
 	return nil
 }
 
-// discoverTemplates adds all *.html.tmpl documents in or at the given path glob to the substructure.
-func (s *Substructure) discoverTemplates(path string) error {
-	var tmplFiles []string
-	if stat, err := os.Stat(path); err != nil {
-		if !os.IsNotExist(err) {
-			return err
-		}
-	} else if stat.IsDir() {
-		tmplf, err := filepathx.Glob(filepath.Join(path, "**", fmt.Sprintf("*%s", templateSuffix)))
-		if err != nil {
-			return err
-		}
-		tmplFiles = append(tmplFiles, tmplf...)
-	} else if strings.HasSuffix(path, templateSuffix) {
-		tmplFiles = append(tmplFiles, path)
-	}
-
-	for _, src := range tmplFiles {
-		if shouldIgnore(src) {
-			continue
-		}
-		slog.Debug(fmt.Sprintf("+ %s", src))
-		meta := NewMetadata(src, tmplPath)
-		s.add(
-			NewHTMLDocument(src, meta,
-				NewTemplateDocument(src, meta, s.docs, s.galleries, nil),
-			),
-		)
-	}
-	for _, d := range s.docs.All {
-		if p, _, ok := strings.Cut(d.Metadata().WebPath, "_"); ok {
-			parent, ok := s.DocBySourcePath(p)
-			if ok {
-				d.Metadata().ParentFilename = parent.Metadata().WebPath
-			}
-		}
-	}
-
-	return nil
-}
-
 // shouldIgnore returns true if the given file path should not be built into the substructure,
 // or false otherwise.
 func shouldIgnore(src string) bool {
@@ -5,21 +5,27 @@ package graphic // import "twos.dev/winter/graphic"
 import (
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 )
 
 var (
 	ImageExts = map[string]struct{}{
+		"avif": {},
+		"gif":  {},
 		"png":  {},
 		"jpg":  {},
 		"jpeg": {},
 		"svg":  {},
+		"webp": {},
 	}
 	VideoExts = map[string]struct{}{
-		"mov": {},
-		"mp4": {},
+		"mov":  {},
+		"mp4":  {},
+		"webm": {},
 	}
 )
 
@@ -35,11 +41,14 @@ type Alt string
 // with a special visual treatment.
 type Caption string
 
-// Discover returns the path to the graphic specified.
+// Discover returns the path to the graphic specified,
+// relative to public.
+// src is the graphic's path in public without its extension.
 // If none exists, os.ErrNotExist is returned.
 //
-// Graphics MUST be built before this is called, because it looks in dist/.
-// TODO: Fix this, perhaps by processing graphics just-in-time if a page that references one is built.
+// To find a graphic by shortname,
+// or in another directory,
+// use [NewIndex] and [Index.Discover].
 func Discover(
 	src SRC,
 	exts map[string]struct{},
@@ -50,7 +59,7 @@ func Discover(
 			if errors.Is(err, os.ErrNotExist) {
 				continue
 			}
-			return "", fmt.Errorf("can't discover graphicShortname: %w", err)
+			return "", fmt.Errorf("can't discover graphic: %w", err)
 		}
 
 		return SRC(path), nil
@@ -71,3 +80,104 @@ func Discover(
 
 	return "", os.ErrNotExist
 }
+
+// ErrAmbiguous is returned by [Index.Discover] when more than one graphic has the shortname given.
+var ErrAmbiguous = errors.New("more than one graphic has that shortname")
+
+// Index is a list of the files in a directory,
+// so graphics can be discovered in it repeatedly without walking it each time.
+// It does not change when the directory does.
+type Index struct {
+	dir   string
+	paths []string
+}
+
+// NewIndex walks dir recursively and returns an index of the files in it.
+// If dir does not exist, the index is empty.
+func NewIndex(dir string) (*Index, error) {
+	idx := &Index{dir: dir}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() {
+			idx.paths = append(idx.paths, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can't index graphics in %s: %w", dir, err)
+	}
+	return idx, nil
+}
+
+// Discover returns the path to the graphic in idx with the given shortname
+// and one of the extensions exts.
+// If there is none, os.ErrNotExist is returned.
+// If there is more than one, ErrAmbiguous is returned.
+//
+// A shortname is the graphic's path relative to the directory it is in,
+// without its extension,
+// or any trailing part of that path;
+// cat, 2023/cat, and img/2023/cat are all shortnames of public/img/2023/cat.png.
+// A shortname can also include an extension to choose among graphics that differ only by extension.
+func (idx *Index) Discover(src SRC, exts map[string]struct{}) (string, error) {
+	shortname := strings.Trim(filepath.ToSlash(string(src)), "/")
+	_, hasExt := exts[strings.ToLower(strings.TrimPrefix(path.Ext(shortname), "."))]
+	var matches []string
+	for _, p := range idx.paths {
+		ext := strings.TrimPrefix(filepath.Ext(p), ".")
+		if _, ok := exts[strings.ToLower(ext)]; !ok {
+			continue
+		}
+		rel, err := filepath.Rel(idx.dir, p)
+		if err != nil {
+			return "", fmt.Errorf("can't discover graphic %q in %s: %w", src, idx.dir, err)
+		}
+		rel = filepath.ToSlash(rel)
+		if !hasExt {
+			rel = strings.TrimSuffix(rel, "."+ext)
+		}
+		if rel == shortname || strings.HasSuffix(rel, "/"+shortname) {
+			matches = append(matches, p)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", os.ErrNotExist
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("%w: %q could be any of %s", ErrAmbiguous, src, strings.Join(matches, ", "))
+	}
+}
+
+// Color scheme variant suffixes.
+// A graphic whose extensionless filename ends in one of these,
+// such as cat-dark.png,
+// is the version of the graphic for that color scheme.
+const (
+	DarkSuffix  = "-dark"
+	LightSuffix = "-light"
+)
+
+// Partner returns the path the opposite color scheme variant of the graphic at src would have,
+// such as cat-light.png for cat-dark.png,
+// and whether src is the dark variant.
+// The partner is not guaranteed to exist.
+//
+// If src is not a color scheme variant, ok is false.
+func Partner(src SRC) (partner SRC, dark, ok bool) {
+	ext := filepath.Ext(string(src))
+	base := strings.TrimSuffix(string(src), ext)
+	switch {
+	case strings.HasSuffix(base, DarkSuffix):
+		return SRC(strings.TrimSuffix(base, DarkSuffix) + LightSuffix + ext), true, true
+	case strings.HasSuffix(base, LightSuffix):
+		return SRC(strings.TrimSuffix(base, LightSuffix) + DarkSuffix + ext), false, true
+	}
+	return "", false, false
+}